@@ -0,0 +1,353 @@
+package common_datalayer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// ChangeTracker turns full snapshots of a source into changes. It keeps a hash of the last seen
+// version of each entity in a local file, and gives each new, changed or deleted entity the next
+// sequence number. Changes emits the entities of a snapshot with a sequence number after the
+// since token, and deletions for the ids that are no longer in the snapshot.
+type ChangeTracker struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	log     *bufio.Writer
+	entries map[string]*trackedEntity
+	records int             // number of records in the store file
+	ignored map[string]bool // properties left out of the hash
+	seq     uint64
+}
+
+// trackedEntity is the last seen version of an entity, the store file has one per line
+type trackedEntity struct {
+	ID      string `json:"id"`
+	Hash    string `json:"hash,omitempty"`
+	Seq     uint64 `json:"seq"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// OpenChangeTracker opens the store file at path, it is created if it does not exist. Each
+// tracked dataset needs a store file of its own. mapper is the mapper of the tracked entities, its
+// provenance properties are left out of the hash so that they do not make every entity a change.
+// It can be nil when the entities are not mapped.
+func OpenChangeTracker(path string, mapper *Mapper) (*ChangeTracker, error) {
+	tracker := &ChangeTracker{path: path, entries: make(map[string]*trackedEntity)}
+	if mapper != nil {
+		tracker.ignored = mapper.provenanceProperties()
+	}
+	records, err := tracker.load(path)
+	if err != nil {
+		return nil, err
+	}
+	tracker.records = records
+	if tracker.needsCompaction() {
+		if err = tracker.compact(path); err != nil {
+			return nil, err
+		}
+	}
+	if err = tracker.open(); err != nil {
+		return nil, err
+	}
+	return tracker, nil
+}
+
+func (t *ChangeTracker) open() error {
+	file, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open change tracker store: %w", err)
+	}
+	t.file = file
+	t.log = bufio.NewWriter(file)
+	return nil
+}
+
+// needsCompaction is true when the store holds more old versions than current ones, the store is
+// append only and rewritten with the current versions when it is opened or saved
+func (t *ChangeTracker) needsCompaction() bool {
+	return t.records > 2*len(t.entries)
+}
+
+// save writes pending records to the store file and compacts it if needed, t.mu must be held
+func (t *ChangeTracker) save() error {
+	if err := t.log.Flush(); err != nil {
+		return fmt.Errorf("could not write to change tracker store: %w", err)
+	}
+	if !t.needsCompaction() {
+		return t.file.Sync()
+	}
+	if err := t.file.Close(); err != nil {
+		return fmt.Errorf("could not close change tracker store: %w", err)
+	}
+	if err := t.compact(t.path); err != nil {
+		// keep the uncompacted store, it holds all current versions
+		if openErr := t.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	return t.open()
+}
+
+// load reads the store file and returns the number of records in it
+func (t *ChangeTracker) load(path string) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not open change tracker store: %w", err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	records := 0
+	for {
+		entry := &trackedEntity{}
+		if err = decoder.Decode(entry); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("could not read change tracker store %s, record %d: %w", path, records, err)
+		}
+		records++
+		t.entries[entry.ID] = entry
+		if entry.Seq > t.seq {
+			t.seq = entry.Seq
+		}
+	}
+}
+
+func (t *ChangeTracker) compact(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not compact change tracker store: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range t.sortedEntries() {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("could not compact change tracker store: %w", err)
+	}
+	t.records = len(t.entries)
+	return nil
+}
+
+func (t *ChangeTracker) sortedEntries() []*trackedEntity {
+	entries := make([]*trackedEntity, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries
+}
+
+// Close writes pending records, compacts the store file if needed and closes it
+func (t *ChangeTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.save(); err != nil {
+		return err
+	}
+	return t.file.Close()
+}
+
+// Changes reads the full snapshot in entities and returns an iterator over the entities that are
+// new or changed after the since token, followed by deletions for the ids that are missing from
+// the snapshot. Deletions are only detected when the snapshot is read to the end. The token of the
+// returned iterator is the sequence number of the store, an empty since returns all entities.
+func (t *ChangeTracker) Changes(since string, entities EntityIterator) (EntityIterator, LayerError) {
+	var after uint64
+	if since != "" {
+		var err error
+		if after, err = strconv.ParseUint(since, 10, 64); err != nil {
+			return nil, Errorf(LayerErrorBadParameter, "invalid since token %s", since)
+		}
+	}
+	return &changeIterator{tracker: t, entities: entities, after: after, seen: make(map[string]bool)}, nil
+}
+
+// track records the version of entity and returns its sequence number
+func (t *ChangeTracker) track(entity *egdm.Entity) (uint64, error) {
+	hash, err := entityHash(entity, t.ignored)
+	if err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[entity.ID]
+	if ok && entry.Hash == hash && entry.Deleted == entity.IsDeleted {
+		return entry.Seq, nil
+	}
+	t.seq++
+	entry = &trackedEntity{ID: entity.ID, Hash: hash, Seq: t.seq, Deleted: entity.IsDeleted}
+	t.entries[entity.ID] = entry
+	return entry.Seq, t.write(entry)
+}
+
+// deleteUnseen marks the entities missing from a snapshot as deleted, and returns the deletions
+// with a sequence number after the since token
+func (t *ChangeTracker) deleteUnseen(seen map[string]bool, after uint64) ([]*egdm.Entity, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, entry := range t.sortedEntries() {
+		if seen[entry.ID] || entry.Deleted {
+			continue
+		}
+		t.seq++
+		deleted := &trackedEntity{ID: entry.ID, Seq: t.seq, Deleted: true}
+		t.entries[entry.ID] = deleted
+		if err := t.write(deleted); err != nil {
+			return nil, err
+		}
+	}
+	deletions := make([]*egdm.Entity, 0)
+	for _, entry := range t.sortedEntries() {
+		if entry.Seq > after && entry.Deleted && !seen[entry.ID] {
+			entity := egdm.NewEntity().SetID(entry.ID)
+			entity.IsDeleted = true
+			deletions = append(deletions, entity)
+		}
+	}
+	return deletions, t.save()
+}
+
+func (t *ChangeTracker) write(entry *trackedEntity) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = t.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write to change tracker store: %w", err)
+	}
+	t.records++
+	return nil
+}
+
+func (t *ChangeTracker) token() *egdm.Continuation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	continuation := egdm.NewContinuation()
+	continuation.Token = strconv.FormatUint(t.seq, 10)
+	return continuation
+}
+
+// entityHash is a stable hash of the id, deleted flag, properties and references of entity. The
+// recorded time and the ignored properties are left out.
+func entityHash(entity *egdm.Entity, ignored map[string]bool) (string, error) {
+	properties := entity.Properties
+	if len(ignored) > 0 {
+		properties = make(map[string]any, len(entity.Properties))
+		for property, value := range entity.Properties {
+			if !ignored[property] {
+				properties[property] = value
+			}
+		}
+	}
+	// encoding/json writes map keys sorted
+	data, err := json.Marshal(struct {
+		ID         string         `json:"id"`
+		Deleted    bool           `json:"deleted"`
+		Properties map[string]any `json:"props"`
+		References map[string]any `json:"refs"`
+	}{entity.ID, entity.IsDeleted, properties, entity.References})
+	if err != nil {
+		return "", fmt.Errorf("could not hash entity %s: %w", entity.ID, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// changeIterator is the EntityIterator returned by ChangeTracker.Changes
+type changeIterator struct {
+	tracker   *ChangeTracker
+	entities  EntityIterator
+	after     uint64
+	seen      map[string]bool
+	exhausted bool
+	deletions []*egdm.Entity
+}
+
+func (it *changeIterator) Context() *egdm.Context {
+	return it.entities.Context()
+}
+
+func (it *changeIterator) Next() (*egdm.Entity, LayerError) {
+	for !it.exhausted {
+		entity, layerErr := it.entities.Next()
+		if layerErr != nil {
+			return nil, layerErr
+		}
+		if entity == nil {
+			it.exhausted = true
+			deletions, err := it.tracker.deleteUnseen(it.seen, it.after)
+			if err != nil {
+				return nil, Err(err, LayerErrorInternal)
+			}
+			it.deletions = deletions
+			break
+		}
+		if entity.ID == "" {
+			return nil, Errorf(LayerErrorInternal, "change tracking requires entity ids")
+		}
+		it.seen[entity.ID] = true
+		seq, err := it.tracker.track(entity)
+		if err != nil {
+			return nil, Err(err, LayerErrorInternal)
+		}
+		if seq > it.after {
+			return entity, nil
+		}
+	}
+	if len(it.deletions) > 0 {
+		entity := it.deletions[0]
+		it.deletions = it.deletions[1:]
+		return entity, nil
+	}
+	return nil, nil
+}
+
+// Token returns the sequence number of the store, it is the since token of the next Changes call
+func (it *changeIterator) Token() (*egdm.Continuation, LayerError) {
+	return it.tracker.token(), nil
+}
+
+// Close saves the store and closes the snapshot, the snapshot is closed also when saving fails
+func (it *changeIterator) Close() LayerError {
+	it.tracker.mu.Lock()
+	err := it.tracker.save()
+	it.tracker.mu.Unlock()
+	closeErr := it.entities.Close()
+	if err != nil {
+		return Err(err, LayerErrorInternal)
+	}
+	return closeErr
+}
@@ -0,0 +1,215 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangeTracker(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	mapper := NewMapper(logger, nil, &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "name", EntityProperty: "name"},
+		},
+	})
+	path := filepath.Join(t.TempDir(), "people.changes")
+	tracker, err := OpenChangeTracker(path, mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changes reads a snapshot and returns the ids, deleted ids prefixed with -, and the token
+	changes := func(since string, people map[string]string) ([]string, string) {
+		items := &sliceItemIterator{}
+		for _, id := range []string{"1", "2", "3"} {
+			if name, ok := people[id]; ok {
+				items.items = append(items.items, MapItem{"id": id, "name": name})
+			}
+		}
+		iterator, layerErr := tracker.Changes(since, NewMappingEntityIterator(mapper, items))
+		if layerErr != nil {
+			t.Fatal(layerErr)
+		}
+		ids := make([]string, 0)
+		for {
+			entity, layerErr := iterator.Next()
+			if layerErr != nil {
+				t.Fatal(layerErr)
+			}
+			if entity == nil {
+				break
+			}
+			id := entity.ID[len("http://data.example.com/people/"):]
+			if entity.IsDeleted {
+				id = "-" + id
+			}
+			ids = append(ids, id)
+		}
+		token, _ := iterator.Token()
+		if layerErr = iterator.Close(); layerErr != nil {
+			t.Fatal(layerErr)
+		}
+		if !items.closed {
+			t.Errorf("expected items to be closed")
+		}
+		return ids, token.Token
+	}
+	expect := func(ids []string, expected ...string) {
+		t.Helper()
+		if len(ids) != len(expected) || len(ids) > 0 && !reflect.DeepEqual(ids, expected) {
+			t.Errorf("expected %v, got %v", expected, ids)
+		}
+	}
+
+	ids, token := changes("", map[string]string{"1": "Homer", "2": "Marge", "3": "Bart"})
+	expect(ids, "1", "2", "3")
+	ids, token = changes(token, map[string]string{"1": "Homer", "2": "Marge", "3": "Bart"})
+	expect(ids)
+	ids, token = changes(token, map[string]string{"1": "Homer", "2": "Marge Simpson"})
+	expect(ids, "2", "-3")
+	if token != "5" {
+		t.Errorf("expected token 5, got %s", token)
+	}
+
+	// the store survives a restart, and earlier tokens still see later changes
+	if err = tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tracker, err = OpenChangeTracker(path, mapper); err != nil {
+		t.Fatal(err)
+	}
+	ids, _ = changes("3", map[string]string{"1": "Homer", "2": "Marge Simpson", "3": "Bart"})
+	expect(ids, "2", "3")
+	ids, _ = changes("", map[string]string{"1": "Homer", "3": "Bart"})
+	expect(ids, "1", "3", "-2")
+
+	// old versions are removed from the store when it is saved
+	records := func() int {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "\n")
+	}
+	if n := records(); n != 3 {
+		t.Errorf("expected compacted store with 3 records, got %d", n)
+	}
+
+	if _, layerErr := tracker.Changes("x", nil); layerErr == nil {
+		t.Errorf("expected invalid token to fail")
+	}
+	if err = tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// and when it is opened, e.g. after a crash
+	store, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := 8; seq < 14; seq++ {
+		_, _ = fmt.Fprintf(store, `{"id":"http://data.example.com/people/4","hash":"%d","seq":%d}`+"\n", seq, seq)
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tracker, err = OpenChangeTracker(path, mapper); err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	if n := records(); n != 4 {
+		t.Errorf("expected compacted store with 4 records, got %d", n)
+	}
+	ids, token = changes("", map[string]string{"1": "Homer", "3": "Bart"})
+	expect(ids, "1", "3", "-2", "-4")
+	if token != "14" {
+		t.Errorf("expected token 14, got %s", token)
+	}
+}
+
+func TestChangeTrackerIgnoresProvenance(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	mapper := NewMapper(logger, nil, &OutgoingMappingConfig{
+		BaseURI:    "http://data.example.com/schema/",
+		Provenance: &ProvenanceConfig{MappedAt: "mappedAt"},
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "name", EntityProperty: "name"},
+		},
+	})
+	tracker, err := OpenChangeTracker(filepath.Join(t.TempDir(), "people.changes"), mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	// count reads a snapshot with the mapped_at property and returns the number of changes, the
+	// entities are wrapped to check that the tracker does not depend on the iterator type
+	count := func(since string) (int, string) {
+		items := &sliceItemIterator{items: []Item{MapItem{"id": "1", "name": "Homer"}}}
+		iterator, layerErr := tracker.Changes(since, wrappedEntityIterator{NewMappingEntityIterator(mapper, items)})
+		if layerErr != nil {
+			t.Fatal(layerErr)
+		}
+		changes := 0
+		for {
+			entity, layerErr := iterator.Next()
+			if layerErr != nil {
+				t.Fatal(layerErr)
+			}
+			if entity == nil {
+				break
+			}
+			if entity.Properties["http://data.example.com/schema/mappedAt"] == nil {
+				t.Errorf("expected mapped_at provenance property on %s", entity.ID)
+			}
+			changes++
+		}
+		token, _ := iterator.Token()
+		_ = iterator.Close()
+		return changes, token.Token
+	}
+
+	changes, token := count("")
+	if changes != 1 {
+		t.Errorf("expected 1 change, got %d", changes)
+	}
+	time.Sleep(time.Millisecond)
+	if changes, _ = count(token); changes != 0 {
+		t.Errorf("expected mapped_at to be left out of the hash, got %d changes", changes)
+	}
+}
+
+type wrappedEntityIterator struct {
+	EntityIterator
+}
+
+func TestChangeIteratorClosesSnapshotWhenSaveFails(t *testing.T) {
+	tracker, err := OpenChangeTracker(filepath.Join(t.TempDir(), "people.changes"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := &sliceItemIterator{}
+	iterator, layerErr := tracker.Changes("", NewMappingEntityIterator(NewMapper(NewLogger("testService", "text", "info"), nil, &OutgoingMappingConfig{}), items))
+	if layerErr != nil {
+		t.Fatal(layerErr)
+	}
+	// saving fails on the closed store file
+	if err = tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if layerErr = iterator.Close(); layerErr == nil {
+		t.Errorf("expected save to fail")
+	}
+	if !items.closed {
+		t.Errorf("expected items to be closed")
+	}
+}
@@ -0,0 +1,87 @@
+// Command roundtrip checks that the outgoing and incoming mapping configs of a dataset are inverse
+// of each other. It reads sample items from a file with the encoder configured in the source_config
+// of the dataset, maps them to entities and back, and reports the properties that are lost, renamed
+// or changed on the way. The exit code is 1 if there are differences and 2 if the check could not run.
+//
+//	roundtrip -config ./config -dataset people -items ./people.csv [-max 1000] [-json]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	cdl "github.com/mimiro-io/common-datalayer"
+	"github.com/mimiro-io/common-datalayer/encoder"
+)
+
+func main() {
+	configPath := flag.String("config", "./config", "config folder of the data layer")
+	dataset := flag.String("dataset", "", "name of the dataset to verify")
+	itemsFile := flag.String("items", "", "file with sample items, encoded as configured in the source_config of the dataset")
+	maxItems := flag.Int("max", 0, "maximum number of items to verify, 0 for all")
+	asJSON := flag.Bool("json", false, "write the report as json")
+	flag.Parse()
+
+	if *dataset == "" || *itemsFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	report, err := run(*configPath, *dataset, *itemsFile, *maxItems)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *asJSON {
+		encoded, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(encoded))
+	} else if err = report.Write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func run(configPath, dataset, itemsFile string, maxItems int) (*cdl.RoundTripReport, error) {
+	logger := cdl.NewLogger("roundtrip", "text", "none")
+	config, err := cdl.LoadConfig(configPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not load config: %w", err)
+	}
+	if err = cdl.LoadLookupTables(config); err != nil {
+		return nil, fmt.Errorf("could not load lookup tables: %w", err)
+	}
+	definition := config.GetDatasetDefinition(dataset)
+	if definition == nil {
+		return nil, fmt.Errorf("dataset %s not found in config", dataset)
+	}
+
+	file, err := os.Open(itemsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open items: %w", err)
+	}
+	items, err := encoder.NewItemIterator(definition.SourceConfig, logger, file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not read items with source config of dataset %s: %w", dataset, err)
+	}
+	if items == nil {
+		file.Close()
+		return nil, fmt.Errorf("unsupported encoding '%v' in source config of dataset %s", definition.SourceConfig["encoding"], dataset)
+	}
+	defer items.Close()
+	factory, err := encoder.NewItemFactory(definition.SourceConfig)
+	if err != nil {
+		return nil, fmt.Errorf("no item factory for source config of dataset %s: %w", dataset, err)
+	}
+	if factory == nil {
+		return nil, fmt.Errorf("unsupported encoding '%v' in source config of dataset %s", definition.SourceConfig["encoding"], dataset)
+	}
+
+	return cdl.VerifyRoundTrip(logger, config.LookupTables(), definition, items, factory.NewItem, maxItems)
+}
@@ -15,49 +15,70 @@ type Config struct {
 	NativeSystemConfig NativeSystemConfig   `json:"system_config"`
 	LayerServiceConfig *LayerServiceConfig  `json:"layer_config"`
 	DatasetDefinitions []*DatasetDefinition `json:"dataset_definitions"`
+	Lookups            []*LookupDefinition  `json:"lookups"`
+	lookupTables       *LookupTables        // loaded by LoadLookupTables
 }
 
 type NativeSystemConfig map[string]any
 
 type LayerServiceConfig struct {
-	Custom                map[string]any `json:"custom"`
-	ServiceName           string         `json:"service_name"`
-	Port                  json.Number    `json:"port"`
-	ConfigRefreshInterval string         `json:"config_refresh_interval"`
-	LogLevel              string         `json:"log_level"`
-	LogFormat             string         `json:"log_format"`
-	StatsdAgentAddress    string         `json:"statsd_agent_address"`
-	StatsdEnabled         bool           `json:"statsd_enabled"`
+	Custom                map[string]any   `json:"custom"`
+	ServiceName           string           `json:"service_name"`
+	Port                  json.Number      `json:"port"`
+	ConfigRefreshInterval string           `json:"config_refresh_interval"`
+	LogLevel              string           `json:"log_level"`
+	LogFormat             string           `json:"log_format"`
+	StatsdAgentAddress    string           `json:"statsd_agent_address"`
+	StatsdEnabled         bool             `json:"statsd_enabled"`
+	TLS                   *TLSConfig       `json:"tls"`
+	RateLimit             *RateLimitConfig `json:"rate_limit"`
 }
 
 type DatasetDefinition struct {
 	SourceConfig          map[string]any         `json:"source_config"`
 	IncomingMappingConfig *IncomingMappingConfig `json:"incoming_mapping_config"`
 	OutgoingMappingConfig *OutgoingMappingConfig `json:"outgoing_mapping_config"`
+	RateLimit             *RateLimitConfig       `json:"rate_limit"`
 	DatasetName           string                 `json:"name"`
+	Description           string                 `json:"description"`
 }
 
-// the operations can be one of the following: concat, split, replace, trim, tolower, toupper, regex, slice
+// the operations can be one of the following: concat, split, replace, trim, tolower, toupper, regex, slice, literal, strip,
+// lookup, reverse_lookup.
+// Alternatively an expression can be given instead of operation and args, e.g. "lower(trim(first)) + '-' + id"
 type PropertyConstructor struct {
 	PropertyName string   `json:"property"`
 	Operation    string   `json:"operation"`
 	Arguments    []string `json:"args"`
+	Expression   string   `json:"expression"`
+	Internal     bool     `json:"internal"` // incoming only: the value feeds other constructions and is not written to the item
 }
 
 type IncomingMappingConfig struct {
-	Custom           map[string]any                 `json:"custom"`
-	BaseURI          string                         `json:"base_uri"`
-	PropertyMappings []*EntityToItemPropertyMapping `json:"property_mappings"`
-	MapNamed         bool                           `json:"map_named"`
+	Custom            map[string]any                 `json:"custom"`
+	BaseURI           string                         `json:"base_uri"`
+	Namespaces        map[string]string              `json:"namespaces"` // prefixes for CURIEs, e.g. "foaf": "http://xmlns.com/foaf/0.1/"
+	Constructions     []*PropertyConstructor         `json:"constructions"`
+	PropertyMappings  []*EntityToItemPropertyMapping `json:"property_mappings"`
+	MapNamed          bool                           `json:"map_named"`
+	MapNamedInclude   []string                       `json:"map_named_include"`   // item property names map_named is limited to
+	MapNamedExclude   []string                       `json:"map_named_exclude"`   // item property names map_named leaves out
+	MapNamedCase      string                         `json:"map_named_case"`      // camel or snake, the local names are kept if empty
+	MapNamedCollision string                         `json:"map_named_collision"` // first (default), error or suffix
+	Filter            string                         `json:"filter"`              // expression, entities for which it is false are not mapped
 }
 
 type OutgoingMappingConfig struct {
 	Custom           map[string]any                 `json:"custom"`
 	BaseURI          string                         `json:"base_uri"`
+	Namespaces       map[string]string              `json:"namespaces"` // prefixes for CURIEs, e.g. "foaf": "http://xmlns.com/foaf/0.1/"
 	Constructions    []*PropertyConstructor         `json:"constructions"`
 	PropertyMappings []*ItemToEntityPropertyMapping `json:"property_mappings"`
 	MapAll           bool                           `json:"map_all"`
-	DefaultType      string                         `json:"default_type"` // the default rdf type if none is specified
+	DefaultType      string                         `json:"default_type"`  // the default rdf type if none is specified
+	Filter           string                         `json:"filter"`        // expression, items for which it is false are filtered
+	FilterAction     string                         `json:"filter_action"` // drop (default) or delete
+	Provenance       *ProvenanceConfig              `json:"provenance"`    // entity properties recording where entities came from
 }
 
 type EntityToItemPropertyMapping struct {
@@ -65,13 +86,19 @@ type EntityToItemPropertyMapping struct {
 	EntityProperty       string `json:"entity_property"`
 	Property             string `json:"property"`
 	Datatype             string `json:"datatype"`
-	DefaultValue         string `json:"default_value"`
+	DefaultValue         string `json:"default_value"`     // converted to the datatype, if set
+	URIValuePattern      string `json:"uri_value_pattern"` // parses ids and references into item properties
 	StripReferencePrefix bool   `json:"strip_ref_prefix"`
 	Required             bool   `json:"required"`
 	IsIdentity           bool   `json:"is_identity"`
 	IsReference          bool   `json:"is_reference"`
 	IsDeleted            bool   `json:"is_deleted"`
 	IsRecorded           bool   `json:"is_recorded"`
+	Condition            string `json:"condition"` // expression, the mapping is only applied if it is true
+	TimeFormat                  // layouts and time zone for time datatypes
+	ListFormat                  // multi valued properties
+	// SubMapping maps sub-entities to nested objects
+	SubMapping *IncomingMappingConfig `json:"sub_mapping"`
 }
 
 type ItemToEntityPropertyMapping struct {
@@ -84,8 +111,15 @@ type ItemToEntityPropertyMapping struct {
 	Required        bool   `json:"required"`
 	IsIdentity      bool   `json:"is_identity"`
 	IsReference     bool   `json:"is_reference"`
-	IsDeleted       bool   `json:"is_deleted"`
-	IsRecorded      bool   `json:"is_recorded"`
+	// InverseEntityProperty makes references navigable from the referenced entities, see Mapper.MapItemToEntities
+	InverseEntityProperty string `json:"inverse_entity_property"`
+	IsDeleted             bool   `json:"is_deleted"`
+	IsRecorded            bool   `json:"is_recorded"`
+	Condition             string `json:"condition"` // expression, the mapping is only applied if it is true
+	TimeFormat                   // layouts and time zone for time datatypes
+	ListFormat                   // multi valued properties
+	// SubMapping maps nested objects to sub-entities
+	SubMapping *OutgoingMappingConfig `json:"sub_mapping"`
 }
 
 /******************************************************************************/
@@ -144,6 +178,12 @@ func (c *Config) GetDatasetDefinition(dataset string) *DatasetDefinition {
 	return nil
 }
 
+// LookupTables returns the lookup tables loaded for the config by LoadLookupTables, or nil if they
+// are not loaded
+func (c *Config) LookupTables() *LookupTables {
+	return c.lookupTables
+}
+
 func (c *Config) equals(conf *Config) bool {
 	return reflect.DeepEqual(c, conf)
 }
@@ -165,6 +205,12 @@ func readConfig(data io.Reader) (*Config, error) {
 	return config, nil
 }
 
+// LoadConfig reads and merges all json files in the config folder at configPath, the same way
+// the service runner does. It is meant for tools working with the configuration of a data layer.
+func LoadConfig(configPath string, logger Logger) (*Config, error) {
+	return loadConfig(configPath, logger)
+}
+
 func loadConfig(configPath string, logger Logger) (*Config, error) {
 	c := newConfig()
 	c.ConfigPath = configPath
@@ -215,6 +261,7 @@ func loadConfig(configPath string, logger Logger) (*Config, error) {
 	}
 
 	addEnvOverrides(c, logger)
+	setProvenanceNames(c)
 	logger.Info("Configuration loaded", "datasets", len(c.DatasetDefinitions))
 	return c, nil
 }
@@ -261,6 +308,31 @@ func addEnvOverrides(c *Config, logger Logger) {
 		logger.Debug("Env override applied", "key", "LOG_FORMAT", "value", val)
 		c.LayerServiceConfig.LogFormat = val
 	}
+
+	val, found = os.LookupEnv("TLS_CERT_FILE")
+	if found {
+		logger.Debug("Env override applied", "key", "TLS_CERT_FILE", "value", val)
+		tlsConfig(c).CertFile = val
+	}
+
+	val, found = os.LookupEnv("TLS_KEY_FILE")
+	if found {
+		logger.Debug("Env override applied", "key", "TLS_KEY_FILE", "value", val)
+		tlsConfig(c).KeyFile = val
+	}
+
+	val, found = os.LookupEnv("TLS_CLIENT_CA_FILE")
+	if found {
+		logger.Debug("Env override applied", "key", "TLS_CLIENT_CA_FILE", "value", val)
+		tlsConfig(c).ClientCAFile = val
+	}
+}
+
+func tlsConfig(c *Config) *TLSConfig {
+	if c.LayerServiceConfig.TLS == nil {
+		c.LayerServiceConfig.TLS = &TLSConfig{}
+	}
+	return c.LayerServiceConfig.TLS
 }
 
 func addConfig(mainConfig *Config, partialConfig *Config, logger Logger) {
@@ -291,6 +363,8 @@ func addConfig(mainConfig *Config, partialConfig *Config, logger Logger) {
 					existingDef.SourceConfig = def.SourceConfig
 					existingDef.IncomingMappingConfig = def.IncomingMappingConfig
 					existingDef.OutgoingMappingConfig = def.OutgoingMappingConfig
+					existingDef.RateLimit = def.RateLimit
+					existingDef.Description = def.Description
 				}
 				break
 			}
@@ -300,4 +374,18 @@ func addConfig(mainConfig *Config, partialConfig *Config, logger Logger) {
 			}
 		}
 	}
+	// lookup tables are merged by name, repeats replace earlier definitions
+	for _, def := range partialConfig.Lookups {
+		replaced := false
+		for i, existing := range mainConfig.Lookups {
+			if existing.Name == def.Name {
+				logger.Info("Updating lookup table", "table", def.Name)
+				mainConfig.Lookups[i] = def
+				replaced = true
+			}
+		}
+		if !replaced {
+			mainConfig.Lookups = append(mainConfig.Lookups, def)
+		}
+	}
 }
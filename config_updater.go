@@ -36,11 +36,16 @@ func asDuration(durationExpr string) (time.Duration, error) {
 	return time.Duration(num) * unitDuration, nil
 }
 
+// configListener is notified by the config updater when the config changes
+type configListener interface {
+	UpdateConfiguration(config *Config) LayerError
+}
+
 func newConfigUpdater(
 	config *Config,
 	enrichConfig func(config *Config) error,
 	l Logger,
-	listeners ...DataLayerService,
+	listeners ...configListener,
 ) (*configUpdater, error) {
 	u := &configUpdater{logger: l}
 	interval := 5 * time.Second
@@ -64,8 +69,9 @@ func newConfigUpdater(
 	return u, nil
 }
 
-func (u *configUpdater) checkForUpdates(enrichConfig func(config *Config) error, logger Logger, listeners ...DataLayerService) {
+func (u *configUpdater) checkForUpdates(enrichConfig func(config *Config) error, logger Logger, listeners ...configListener) {
 	logger.Debug("checking config for updates in " + u.config.ConfigPath + ".")
+	u.config.lookupTables.refresh(logger)
 	loadedConf, err := loadConfig(u.config.ConfigPath, logger)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to load config: %v", err.Error()))
@@ -78,8 +84,15 @@ func (u *configUpdater) checkForUpdates(enrichConfig func(config *Config) error,
 			return
 		}
 	}
+	// the tables are reloaded in place, so that mappers and registered providers keep them
+	loadedConf.lookupTables = u.config.lookupTables
 	if !u.config.equals(loadedConf) {
 		logger.Info("Config changed, updating...")
+		err = LoadLookupTables(loadedConf)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to load lookup tables: %v", err.Error()))
+			return
+		}
 		for _, listener := range listeners {
 			err = listener.UpdateConfiguration(loadedConf)
 			if err != nil {
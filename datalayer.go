@@ -2,6 +2,7 @@ package common_datalayer
 
 import (
 	"context"
+	"time"
 
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 )
@@ -39,33 +40,97 @@ type EntityIterator interface {
 	Close() LayerError
 }
 
+// Dataset is the minimal interface of a dataset. Datasets declare the operations they support
+// by implementing any of FullSyncDataset, IncrementalDataset, ChangesDataset and EntitiesDataset
+// (or the ReadableDataset, WritableDataset and CompleteDataset combinations). Requests for
+// operations a dataset does not implement are answered with 405 Method Not Allowed or 501 Not Implemented.
 type Dataset interface {
 	MetaData() map[string]any
 	Name() string
+}
 
+type FullSyncDataset interface {
+	Dataset
 	// FullSync produces a DatasetWriter, which depending on fullsync state in batchInfo
 	// starts, continues or ends a fullsync operation spanning over multiple requests.
 	// Layers should also remove stale entities after a fullsync finishes.
 	FullSync(ctx context.Context, batchInfo BatchInfo) (DatasetWriter, LayerError)
+}
+
+type IncrementalDataset interface {
+	Dataset
 	// Incremental produces a DatasetWriter, which appends changes to the dataset when
 	// written to.
 	Incremental(ctx context.Context) (DatasetWriter, LayerError)
+}
 
+type ChangesDataset interface {
+	Dataset
 	// Changes retrieves changes in a dataset. Use since parameter to
 	// continue consumption of changes in succesive requests
 	Changes(since string, limit int, latestOnly bool) (EntityIterator, LayerError)
+}
+
+type EntitiesDataset interface {
+	Dataset
 	// Entities retrieves all current entities in a dataset. Use from+limit parameters
 	// to page through large datasets in batches.
 	Entities(from string, limit int) (EntityIterator, LayerError)
 }
 
+// ReadableDataset is a read-only dataset
+type ReadableDataset interface {
+	ChangesDataset
+	EntitiesDataset
+}
+
+// WritableDataset is a write-only dataset
+type WritableDataset interface {
+	FullSyncDataset
+	IncrementalDataset
+}
+
+// CompleteDataset supports all operations
+type CompleteDataset interface {
+	ReadableDataset
+	WritableDataset
+}
+
+// SinceCapable can optionally be implemented by a ChangesDataset to declare whether it
+// supports continuing from a since token. Datasets not implementing it are assumed to support since.
+type SinceCapable interface {
+	SupportsSince() bool
+}
+
+// LatestOnlyCapable can optionally be implemented by a ChangesDataset to declare whether
+// it supports the latestOnly parameter. Datasets not implementing it are assumed to support latestOnly.
+type LatestOnlyCapable interface {
+	SupportsLatestOnly() bool
+}
+
 type DatasetWriter interface {
 	Write(entity *egdm.Entity) LayerError
 	Close() LayerError
 }
 
 type DatasetDescription struct {
-	Metadata    map[string]any `json:"metadata"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
+	Metadata     map[string]any `json:"metadata"`
+	LastChange   *time.Time     `json:"last_change,omitempty"`
+	EntityCount  *int64         `json:"entity_count,omitempty"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	Capabilities []string       `json:"capabilities"`
+	EntityTypes  []string       `json:"entity_types,omitempty"`
+}
+
+// EntityCounter can optionally be implemented by a Dataset to report the number of
+// entities in the dataset in GET /datasets
+type EntityCounter interface {
+	EntityCount() (int64, LayerError)
+}
+
+// LastChangeReporter can optionally be implemented by a Dataset to report when the
+// dataset was last changed in GET /datasets
+type LastChangeReporter interface {
+	LastChange() (time.Time, LayerError)
 }
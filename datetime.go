@@ -0,0 +1,213 @@
+package common_datalayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// time datatypes supported in property mappings
+const (
+	DatatypeDateTime = "datetime"
+	DatatypeDate     = "date"
+	DatatypeTime     = "time"
+	DatatypeUnix     = "unix"
+	DatatypeUnixMs   = "unix_ms"
+)
+
+// TimeFormat controls parsing and formatting of time datatypes in property mappings.
+// InputLayout and OutputLayout are go reference time layouts, e.g. 2006-01-02, or one of the
+// names in namedLayouts. TimeZone is an IANA time zone name, e.g. Europe/Oslo, it is used for
+// input without zone information and all output. It defaults to UTC.
+type TimeFormat struct {
+	InputLayout  string `json:"input_layout"`
+	OutputLayout string `json:"output_layout"`
+	TimeZone     string `json:"time_zone"`
+}
+
+var namedLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// layouts tried in order when no input layout is configured
+var defaultInputLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	time.DateTime,
+	time.DateOnly,
+	time.TimeOnly,
+	"15:04",
+}
+
+var locationCache sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "UTC" {
+		return time.UTC, nil
+	}
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone '%s': %w", name, err)
+	}
+	locationCache.Store(name, loc)
+	return loc, nil
+}
+
+func resolveLayout(layout string) string {
+	if named, ok := namedLayouts[layout]; ok {
+		return named
+	}
+	return layout
+}
+
+// timeOfValue converts time.Time, strings and epoch numbers to time.Time. Strings are parsed with
+// layout, or the default layouts if layout is empty, in loc if they carry no zone. Numbers are
+// interpreted as multiples of epochUnit since the unix epoch, or seconds if epochUnit is 0. Strings
+// are only read as epoch numbers if epochUnit is set, so that e.g. 20240101 is not taken for a
+// time in 1970.
+func timeOfValue(val any, layout string, loc *time.Location, epochUnit time.Duration) (time.Time, error) {
+	switch v := val.(type) {
+	case nil:
+		return time.Time{}, fmt.Errorf("value is nil")
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, fmt.Errorf("value is nil")
+		}
+		return *v, nil
+	case json.Number:
+		if epochUnit == 0 {
+			return epochTime(v, time.Second)
+		}
+		return timeOfValue(string(v), layout, loc, epochUnit)
+	case string:
+		s := strings.TrimSpace(v)
+		if layout != "" {
+			t, err := time.ParseInLocation(resolveLayout(layout), s, loc)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("value '%s' does not match layout '%s': %w", s, layout, err)
+			}
+			return t, nil
+		}
+		for _, l := range defaultInputLayouts {
+			if t, err := time.ParseInLocation(l, s, loc); err == nil {
+				return t, nil
+			}
+		}
+		// strings containing epoch numbers, e.g. from csv files
+		if epochUnit != 0 {
+			if n, err := int64OfValue(s); err == nil {
+				return epochTime(n, epochUnit)
+			}
+		}
+		return time.Time{}, fmt.Errorf("value '%s' is not a recognised date or time", s)
+	}
+	if epochUnit == 0 {
+		epochUnit = time.Second
+	}
+	return epochTime(val, epochUnit)
+}
+
+// epochTime converts an epoch number in unit to time.Time
+func epochTime(val any, unit time.Duration) (time.Time, error) {
+	if number, ok := val.(json.Number); ok {
+		if i, err := number.Int64(); err == nil {
+			val = i
+		}
+	}
+	switch v := val.(type) {
+	case float32, float64, json.Number:
+		f, err := float64OfValue(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		seconds, fraction := math.Modf(f * float64(unit) / float64(time.Second))
+		if math.IsNaN(seconds) || seconds < math.MinInt64 || seconds >= math.MaxInt64 {
+			return time.Time{}, fmt.Errorf("value %v is out of range for a time", val)
+		}
+		return time.Unix(int64(seconds), int64(fraction*float64(time.Second))), nil
+	}
+
+	n, err := int64OfValue(val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("value %v of type %T cannot be converted to time", val, val)
+	}
+	switch unit {
+	case time.Millisecond:
+		return time.UnixMilli(n), nil
+	case time.Microsecond:
+		return time.UnixMicro(n), nil
+	case time.Nanosecond:
+		return time.Unix(0, n), nil
+	case time.Second:
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unsupported epoch unit %s", unit)
+}
+
+// newTimeConverter resolves the time zone and layouts of format once and returns a converter to
+// the given time datatype.
+//
+//	datetime: time.Time, or a string if an output layout is configured
+//	date:     string formatted as 2006-01-02 unless another output layout is configured
+//	time:     string formatted as 15:04:05 unless another output layout is configured
+//	unix:     int64 seconds since the epoch
+//	unix_ms:  int64 milliseconds since the epoch
+func newTimeConverter(datatype string, format TimeFormat) (converter, error) {
+	loc, err := loadLocation(format.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	// strings are only epoch numbers for the epoch datatypes
+	var epochUnit time.Duration
+	switch datatype {
+	case DatatypeUnix:
+		epochUnit = time.Second
+	case DatatypeUnixMs:
+		epochUnit = time.Millisecond
+	}
+
+	outputLayout := resolveLayout(format.OutputLayout)
+	switch datatype {
+	case DatatypeDate:
+		if outputLayout == "" {
+			outputLayout = time.DateOnly
+		}
+	case DatatypeTime:
+		if outputLayout == "" {
+			outputLayout = time.TimeOnly
+		}
+	}
+
+	return func(val any) (any, error) {
+		t, err := timeOfValue(val, format.InputLayout, loc, epochUnit)
+		if err != nil {
+			return nil, err
+		}
+		t = t.In(loc)
+
+		switch datatype {
+		case DatatypeUnix:
+			return t.Unix(), nil
+		case DatatypeUnixMs:
+			return t.UnixMilli(), nil
+		}
+		if outputLayout == "" {
+			return t, nil
+		}
+		return t.Format(outputLayout), nil
+	}, nil
+}
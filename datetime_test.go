@@ -0,0 +1,77 @@
+package common_datalayer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeConverter(t *testing.T) {
+	convert := func(datatype string, value any, format TimeFormat) (any, error) {
+		c, err := newTimeConverter(datatype, format)
+		if err != nil {
+			return nil, err
+		}
+		return c(value)
+	}
+
+	born := time.Date(1956, 5, 12, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		datatype string
+		value    any
+		format   TimeFormat
+		expected any
+	}{
+		{datatype: DatatypeDateTime, value: "1956-05-12T22:30:00Z", expected: born},
+		{datatype: DatatypeDateTime, value: "1956-05-12 22:30:00", expected: born},
+		{datatype: DatatypeDateTime, value: born.Unix(), expected: born},
+		{datatype: DatatypeDateTime, value: float64(born.Unix()), expected: born},
+		{datatype: DatatypeDateTime, value: "12.05.1956 22:30", format: TimeFormat{InputLayout: "02.01.2006 15:04"}, expected: born},
+		{datatype: DatatypeDateTime, value: born, format: TimeFormat{OutputLayout: "RFC1123"}, expected: "Sat, 12 May 1956 22:30:00 UTC"},
+		{datatype: DatatypeDateTime, value: born, format: TimeFormat{OutputLayout: "RFC3339", TimeZone: "Europe/Oslo"}, expected: "1956-05-12T23:30:00+01:00"},
+		{datatype: DatatypeDateTime, value: "1956-05-12 23:30:00", format: TimeFormat{OutputLayout: "RFC3339", TimeZone: "Europe/Oslo"}, expected: "1956-05-12T23:30:00+01:00"},
+		{datatype: DatatypeDate, value: born, expected: "1956-05-12"},
+		{datatype: DatatypeDate, value: born, format: TimeFormat{TimeZone: "Asia/Tokyo"}, expected: "1956-05-13"},
+		{datatype: DatatypeTime, value: born, expected: "22:30:00"},
+		{datatype: DatatypeTime, value: "22:30", format: TimeFormat{OutputLayout: "3:04PM"}, expected: "10:30PM"},
+		{datatype: DatatypeUnix, value: "1956-05-12T22:30:00Z", expected: born.Unix()},
+		{datatype: DatatypeUnix, value: "-493868", expected: int64(-493868)},
+		{datatype: DatatypeUnixMs, value: born, expected: born.UnixMilli()},
+		{datatype: DatatypeUnixMs, value: born.UnixMilli(), format: TimeFormat{OutputLayout: "DateOnly"}, expected: born.UnixMilli()},
+		{datatype: DatatypeUnix, value: "20240101", expected: int64(20240101)},
+		{datatype: DatatypeDateTime, value: int64(32503680000), expected: time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{datatype: DatatypeDate, value: int64(-11676096000), expected: "1600-01-01"},
+		{datatype: DatatypeUnixMs, value: "32503680000000", format: TimeFormat{}, expected: int64(32503680000000)},
+	}
+
+	for _, test := range tests {
+		value, err := convert(test.datatype, test.value, test.format)
+		if err != nil {
+			t.Errorf("%s %v: unexpected error %v", test.datatype, test.value, err)
+			continue
+		}
+		if expectedTime, ok := test.expected.(time.Time); ok {
+			if actual, ok := value.(time.Time); !ok || !actual.Equal(expectedTime) {
+				t.Errorf("%s %v: expected %v, got %v", test.datatype, test.value, test.expected, value)
+			}
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("%s %v: expected %v (%T), got %v (%T)", test.datatype, test.value, test.expected, test.expected, value, value)
+		}
+	}
+
+	if _, err := convert(DatatypeDate, "yesterday", TimeFormat{}); err == nil {
+		t.Error("invalid date should fail")
+	}
+	for _, value := range []string{"20240101", "2024"} {
+		if _, err := convert(DatatypeDateTime, value, TimeFormat{}); err == nil {
+			t.Errorf("numeric string %s should not be read as epoch for datetime", value)
+		}
+	}
+	if _, err := convert(DatatypeDate, "1956-05-12", TimeFormat{InputLayout: "02.01.2006"}); err == nil {
+		t.Error("value not matching input layout should fail")
+	}
+	if _, err := convert(DatatypeDate, born, TimeFormat{TimeZone: "Mars/Olympus"}); err == nil {
+		t.Error("invalid time zone should fail")
+	}
+}
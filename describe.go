@@ -0,0 +1,226 @@
+package common_datalayer
+
+import (
+	"path"
+	"slices"
+	"sort"
+)
+
+const (
+	OperationFullSync    = "fullsync"
+	OperationIncremental = "incremental"
+	OperationChanges     = "changes"
+	OperationEntities    = "entities"
+
+	CapabilitySince      = "since"
+	CapabilityLatestOnly = "latest_only"
+)
+
+// DatasetDetails is the self description of a dataset returned by GET /datasets/:dataset
+type DatasetDetails struct {
+	DatasetDescription
+	OutgoingProperties []*EntityPropertyDescription `json:"outgoing_properties"`
+	IncomingProperties []*EntityPropertyDescription `json:"incoming_properties"`
+}
+
+// EntityPropertyDescription describes an entity property as defined by a property mapping
+type EntityPropertyDescription struct {
+	EntityProperty  string `json:"entity_property,omitempty"`
+	Property        string `json:"property"`
+	Datatype        string `json:"datatype,omitempty"`
+	URIValuePattern string `json:"uri_value_pattern,omitempty"`
+	IsIdentity      bool   `json:"is_identity,omitempty"`
+	IsReference     bool   `json:"is_reference,omitempty"`
+	Required        bool   `json:"required,omitempty"`
+}
+
+// describeDataset completes the description provided by the layer with information from the
+// dataset definition and the optional interfaces implemented by the dataset. Values provided
+// by the layer take precedence. ds, description and definition may be nil.
+func describeDataset(logger Logger, ds Dataset, description *DatasetDescription, definition *DatasetDefinition) *DatasetDescription {
+	result := &DatasetDescription{Metadata: make(map[string]any)}
+	if description != nil {
+		*result = *description
+		result.Metadata = make(map[string]any)
+		for k, v := range description.Metadata {
+			result.Metadata[k] = v
+		}
+	}
+	if ds != nil {
+		if result.Name == "" {
+			result.Name = ds.Name()
+		}
+		for k, v := range ds.MetaData() {
+			if _, ok := result.Metadata[k]; !ok {
+				result.Metadata[k] = v
+			}
+		}
+	}
+
+	if definition != nil {
+		if result.Description == "" {
+			result.Description = definition.Description
+		}
+		if definition.OutgoingMappingConfig != nil && definition.OutgoingMappingConfig.DefaultType != "" &&
+			!slices.Contains(result.EntityTypes, definition.OutgoingMappingConfig.DefaultType) {
+			result.EntityTypes = append(result.EntityTypes, definition.OutgoingMappingConfig.DefaultType)
+		}
+	}
+
+	if result.Capabilities == nil {
+		result.Capabilities = datasetCapabilities(ds, definition)
+	}
+	return result
+}
+
+// addDatasetStatistics sets the entity count and last change of description from datasets that
+// implement EntityCounter or LastChangeReporter. These can be expensive, e.g. counting the rows
+// of a table, so the dataset list only includes them on request.
+func addDatasetStatistics(logger Logger, ds Dataset, result *DatasetDescription) {
+	if counter, ok := ds.(EntityCounter); ok && result.EntityCount == nil {
+		count, err := counter.EntityCount()
+		if err != nil {
+			logger.Warn("Failed to count entities", "dataset", result.Name, "error", err.Error())
+		} else {
+			result.EntityCount = &count
+		}
+	}
+	if reporter, ok := ds.(LastChangeReporter); ok && result.LastChange == nil {
+		lastChange, err := reporter.LastChange()
+		if err != nil {
+			logger.Warn("Failed to get last change", "dataset", result.Name, "error", err.Error())
+		} else {
+			result.LastChange = &lastChange
+		}
+	}
+}
+
+// newDatasetDetails combines the dataset description and the property mappings of the
+// dataset definition into a DatasetDetails. description and definition may be nil.
+func newDatasetDetails(logger Logger, ds Dataset, description *DatasetDescription, definition *DatasetDefinition) *DatasetDetails {
+	details := &DatasetDetails{DatasetDescription: *describeDataset(logger, ds, description, definition)}
+	addDatasetStatistics(logger, ds, &details.DatasetDescription)
+	if definition != nil && definition.OutgoingMappingConfig != nil {
+		details.OutgoingProperties = describeOutgoingMappings(definition.OutgoingMappingConfig)
+	}
+	if definition != nil && definition.IncomingMappingConfig != nil {
+		details.IncomingProperties = describeIncomingMappings(definition.IncomingMappingConfig)
+	}
+	return details
+}
+
+// filterDatasetDescriptions keeps descriptions whose name matches the glob pattern and that
+// have the given capability and entity type. Empty filters match everything. The result is
+// sorted by name.
+func filterDatasetDescriptions(descriptions []*DatasetDescription, namePattern string, capability string, entityType string) []*DatasetDescription {
+	result := make([]*DatasetDescription, 0, len(descriptions))
+	for _, d := range descriptions {
+		if namePattern != "" {
+			if ok, err := path.Match(namePattern, d.Name); err != nil || !ok {
+				continue
+			}
+		}
+		if capability != "" && !slices.Contains(d.Capabilities, capability) {
+			continue
+		}
+		if entityType != "" && !slices.Contains(d.EntityTypes, entityType) {
+			continue
+		}
+		result = append(result, d)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// datasetCapabilities lists the operations and features supported by the dataset, as declared
+// by the interfaces it implements. Without a dataset the operations are derived from the
+// mapping configs, writes require an incoming mapping and reads require an outgoing mapping.
+func datasetCapabilities(ds Dataset, definition *DatasetDefinition) []string {
+	capabilities := make([]string, 0, 6)
+	if ds == nil {
+		if definition == nil || definition.IncomingMappingConfig != nil {
+			capabilities = append(capabilities, OperationFullSync, OperationIncremental)
+		}
+		if definition == nil || definition.OutgoingMappingConfig != nil {
+			capabilities = append(capabilities, OperationChanges, OperationEntities)
+		}
+		return capabilities
+	}
+
+	if _, ok := ds.(FullSyncDataset); ok {
+		capabilities = append(capabilities, OperationFullSync)
+	}
+	if _, ok := ds.(IncrementalDataset); ok {
+		capabilities = append(capabilities, OperationIncremental)
+	}
+	if _, ok := ds.(ChangesDataset); ok {
+		capabilities = append(capabilities, OperationChanges)
+		if supportsSince(ds) {
+			capabilities = append(capabilities, CapabilitySince)
+		}
+		if supportsLatestOnly(ds) {
+			capabilities = append(capabilities, CapabilityLatestOnly)
+		}
+	}
+	if _, ok := ds.(EntitiesDataset); ok {
+		capabilities = append(capabilities, OperationEntities)
+	}
+	return capabilities
+}
+
+func supportsSince(ds Dataset) bool {
+	if c, ok := ds.(SinceCapable); ok {
+		return c.SupportsSince()
+	}
+	return true
+}
+
+func supportsLatestOnly(ds Dataset) bool {
+	if c, ok := ds.(LatestOnlyCapable); ok {
+		return c.SupportsLatestOnly()
+	}
+	return true
+}
+
+func describeOutgoingMappings(config *OutgoingMappingConfig) []*EntityPropertyDescription {
+	properties := make([]*EntityPropertyDescription, 0, len(config.PropertyMappings))
+	baseURI := normalizeBaseURI(config.BaseURI)
+	for _, mapping := range config.PropertyMappings {
+		entityProperty := mapping.EntityProperty
+		if entityProperty != "" {
+			entityProperty, _ = resolveURI(entityProperty, baseURI, config.Namespaces)
+		}
+		properties = append(properties, &EntityPropertyDescription{
+			EntityProperty:  entityProperty,
+			Property:        mapping.Property,
+			Datatype:        mapping.Datatype,
+			URIValuePattern: mapping.URIValuePattern,
+			IsIdentity:      mapping.IsIdentity,
+			IsReference:     mapping.IsReference,
+			Required:        mapping.Required,
+		})
+	}
+	return properties
+}
+
+func describeIncomingMappings(config *IncomingMappingConfig) []*EntityPropertyDescription {
+	properties := make([]*EntityPropertyDescription, 0, len(config.PropertyMappings))
+	baseURI := normalizeBaseURI(config.BaseURI)
+	for _, mapping := range config.PropertyMappings {
+		entityProperty := mapping.EntityProperty
+		if entityProperty != "" {
+			entityProperty, _ = resolveURI(entityProperty, baseURI, config.Namespaces)
+		}
+		properties = append(properties, &EntityPropertyDescription{
+			EntityProperty: entityProperty,
+			Property:       mapping.Property,
+			Datatype:       mapping.Datatype,
+			IsIdentity:     mapping.IsIdentity,
+			IsReference:    mapping.IsReference,
+			Required:       mapping.Required,
+		})
+	}
+	return properties
+}
@@ -0,0 +1,156 @@
+package common_datalayer
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type describeTestDataset struct{}
+
+func (d *describeTestDataset) MetaData() map[string]any { return map[string]any{"rows": 10} }
+func (d *describeTestDataset) Name() string             { return "people" }
+func (d *describeTestDataset) Changes(since string, limit int, latestOnly bool) (EntityIterator, LayerError) {
+	return nil, nil
+}
+func (d *describeTestDataset) Entities(from string, limit int) (EntityIterator, LayerError) {
+	return nil, nil
+}
+
+func TestDatasetDetailsFromMappings(t *testing.T) {
+	definition := &DatasetDefinition{
+		DatasetName: "people",
+		OutgoingMappingConfig: &OutgoingMappingConfig{
+			BaseURI: "http://data.example.com/schema",
+			PropertyMappings: []*ItemToEntityPropertyMapping{
+				{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+				{Property: "name", EntityProperty: "name", Datatype: "string", Required: true},
+				{Property: "org", EntityProperty: "http://data.example.com/schema/worksFor", IsReference: true},
+				{Property: "status", EntityProperty: "httpStatus"},
+			},
+		},
+	}
+	description := &DatasetDescription{Name: "people", Description: "all the people", Metadata: map[string]any{"owner": "hr"}}
+
+	logger := NewLogger("testService", "text", "debug")
+	details := newDatasetDetails(logger, &describeTestDataset{}, description, definition)
+
+	if details.Description != "all the people" {
+		t.Error("description should be taken from the dataset description")
+	}
+	if details.Metadata["owner"] != "hr" || details.Metadata["rows"] != 10 {
+		t.Errorf("metadata should combine description metadata and dataset metadata, got %v", details.Metadata)
+	}
+	if !slices.Equal(details.Capabilities, []string{OperationChanges, CapabilitySince, CapabilityLatestOnly, OperationEntities}) {
+		t.Errorf("only read capabilities expected for read-only dataset, got %v", details.Capabilities)
+	}
+	if len(details.OutgoingProperties) != 4 {
+		t.Fatalf("expected 4 outgoing properties, got %d", len(details.OutgoingProperties))
+	}
+	if details.OutgoingProperties[1].EntityProperty != "http://data.example.com/schema/name" {
+		t.Errorf("entity property should be resolved against base uri, got %s", details.OutgoingProperties[1].EntityProperty)
+	}
+	if details.OutgoingProperties[2].EntityProperty != "http://data.example.com/schema/worksFor" {
+		t.Errorf("full entity property uri should be kept, got %s", details.OutgoingProperties[2].EntityProperty)
+	}
+	if details.OutgoingProperties[3].EntityProperty != "http://data.example.com/schema/httpStatus" {
+		t.Errorf("names starting with http should be resolved like the mapper does, got %s", details.OutgoingProperties[3].EntityProperty)
+	}
+}
+
+type countingTestDataset struct {
+	describeTestDataset
+}
+
+func (d *countingTestDataset) EntityCount() (int64, LayerError) { return 42, nil }
+
+func TestDescribeDatasetFromConfigAndOptionalInterfaces(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	definition := &DatasetDefinition{
+		DatasetName:           "people",
+		Description:           "people from config",
+		OutgoingMappingConfig: &OutgoingMappingConfig{DefaultType: "http://data.example.com/Person"},
+	}
+
+	d := describeDataset(logger, &countingTestDataset{}, &DatasetDescription{Name: "people"}, definition)
+	if d.Description != "people from config" {
+		t.Errorf("description should be taken from config, got %s", d.Description)
+	}
+	if len(d.EntityTypes) != 1 || d.EntityTypes[0] != "http://data.example.com/Person" {
+		t.Errorf("entity types should contain default type, got %v", d.EntityTypes)
+	}
+	if d.EntityCount != nil {
+		t.Error("entity count should only be added with the statistics")
+	}
+	addDatasetStatistics(logger, &countingTestDataset{}, d)
+	if d.EntityCount == nil || *d.EntityCount != 42 {
+		t.Error("entity count should be provided by EntityCounter")
+	}
+	if d.LastChange != nil {
+		t.Error("last change should not be set when not supported by the dataset")
+	}
+
+	d = describeDataset(logger, nil, &DatasetDescription{Name: "people", Description: "from layer"}, definition)
+	if d.Description != "from layer" {
+		t.Error("description from layer should take precedence")
+	}
+}
+
+func TestDatasetCapabilitiesFromConfig(t *testing.T) {
+	capabilities := datasetCapabilities(nil, &DatasetDefinition{IncomingMappingConfig: &IncomingMappingConfig{}})
+	if !slices.Equal(capabilities, []string{OperationFullSync, OperationIncremental}) {
+		t.Errorf("only write operations expected with only incoming mapping, got %v", capabilities)
+	}
+}
+
+func TestFilterDatasetDescriptions(t *testing.T) {
+	descriptions := []*DatasetDescription{
+		{Name: "people.employees", Capabilities: []string{OperationChanges}},
+		{Name: "animals", Capabilities: []string{OperationChanges, OperationIncremental}},
+		{Name: "people.customers", Capabilities: []string{OperationIncremental}, EntityTypes: []string{"http://data.example.com/Customer"}},
+	}
+
+	all := filterDatasetDescriptions(descriptions, "", "", "")
+	if len(all) != 3 || all[0].Name != "animals" || all[1].Name != "people.customers" || all[2].Name != "people.employees" {
+		t.Errorf("expected all datasets sorted by name, got %v", all)
+	}
+	people := filterDatasetDescriptions(descriptions, "people.*", OperationIncremental, "")
+	if len(people) != 1 || people[0].Name != "people.customers" {
+		t.Errorf("expected only people.customers, got %v", people)
+	}
+	customers := filterDatasetDescriptions(descriptions, "", "", "http://data.example.com/Customer")
+	if len(customers) != 1 {
+		t.Errorf("expected one dataset of type Customer, got %v", customers)
+	}
+}
+
+func TestOpenAPISpecCoversAllRoutes(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	metrics, _ := newMetrics(&Config{LayerServiceConfig: &LayerServiceConfig{}})
+	ws, err := newDataLayerWebService(&Config{LayerServiceConfig: &LayerServiceConfig{}}, logger, metrics, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	param := regexp.MustCompile(`:(\w+)`)
+	for _, route := range ws.e.Routes() {
+		path := param.ReplaceAllString(route.Path, "{$1}")
+		operations, ok := spec.Paths[path]
+		if !ok {
+			t.Errorf("route %s missing in openapi spec", path)
+			continue
+		}
+		if _, ok := operations[strings.ToLower(route.Method)]; !ok {
+			t.Errorf("method %s of route %s missing in openapi spec", route.Method, path)
+		}
+	}
+}
@@ -56,18 +56,31 @@ func NewItemFactory(sourceConfig map[string]any) (ItemFactory, error) {
 		return nil, errors.New("no encoding specified in source config")
 	}
 
+	// the factories of encoders with columns make items with the schema of the source config
 	if encoding == "json" {
 		return &JsonItemFactory{}, nil
 	}
 	if encoding == "csv" {
-		return &CSVItemFactory{}, nil
+		config, err := NewCSVEncoderConfig(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &CSVItemFactory{schema: csvSchema(config)}, nil
 
 	}
 	if encoding == "flatfile" {
-		return &FlatFileItemFactory{}, nil
+		schema, err := flatFileSchema(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &FlatFileItemFactory{schema: schema}, nil
 	}
 	if encoding == "parquet" {
-		return &ParquetItemFactory{}, nil
+		schema, err := parquetItemSchema(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &ParquetItemFactory{schema: schema}, nil
 	}
 
 	return nil, nil
@@ -99,6 +112,59 @@ func NewConcatenatingWriter(sourceConfig map[string]any, output io.WriteCloser)
 	return nil, nil
 }
 
+// itemSource is embedded in the items read by the item iterators and makes them cdl.SourcedItems
+type itemSource struct {
+	source string
+	offset int
+}
+
+func (s itemSource) Source() string { return s.source }
+func (s itemSource) Offset() int    { return s.offset }
+
+// itemSchema is embedded in the items of encoders that know the columns of their source and makes
+// them cdl.SchemaItems
+type itemSchema struct {
+	schema cdl.Schema
+}
+
+func (s itemSchema) Schema() cdl.Schema { return s.schema }
+
+// propertyNames returns the names of the values in schema order, followed by the names that are
+// not in the schema sorted
+func (s itemSchema) propertyNames(values cdl.MapItem) []string {
+	if len(s.schema) == 0 {
+		return values.GetPropertyNames()
+	}
+	names := make([]string, 0, len(values))
+	inSchema := make(map[string]bool, len(s.schema))
+	for _, field := range s.schema {
+		inSchema[field.Name] = true
+		if _, ok := values[field.Name]; ok {
+			names = append(names, field.Name)
+		}
+	}
+	if len(names) < len(values) {
+		for _, name := range values.GetPropertyNames() {
+			if !inSchema[name] {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// sourceName identifies the source of the items read from data, it is the "source" key of the source
+// config if set, otherwise the file name if data is a file
+func sourceName(sourceConfig map[string]any, data io.Reader) string {
+	if source, ok := sourceConfig["source"].(string); ok && source != "" {
+		return source
+	}
+	if file, ok := data.(interface{ Name() string }); ok {
+		return file.Name()
+	}
+	return ""
+}
+
 type ItemFactory interface {
 	NewItem() cdl.Item
 }
@@ -6,18 +6,22 @@ import (
 	"errors"
 	cdl "github.com/mimiro-io/common-datalayer"
 	"io"
+	"math/big"
 	"slices"
 	"strconv"
+	"time"
 )
 
 func NewCSVItemFactory() ItemFactory {
 	return &CSVItemFactory{}
 }
 
-type CSVItemFactory struct{}
+type CSVItemFactory struct {
+	schema cdl.Schema
+}
 
 func (c *CSVItemFactory) NewItem() cdl.Item {
-	return &CSVItem{data: make(map[string]any)}
+	return &CSVItem{MapItem: cdl.NewMapItem(), itemSchema: itemSchema{c.schema}}
 }
 
 type CSVEncoderConfig struct {
@@ -45,6 +49,17 @@ func NewCSVEncoderConfig(sourceConfig map[string]any) (*CSVEncoderConfig, error)
 	return config, nil
 }
 
+// csvSchema returns the columns that are read as untyped schema
+func csvSchema(config *CSVEncoderConfig) cdl.Schema {
+	var schema cdl.Schema
+	for _, column := range config.Columns {
+		if !slices.Contains(config.IgnoreColumns, column) {
+			schema = append(schema, cdl.SchemaField{Name: column})
+		}
+	}
+	return schema
+}
+
 type CSVItemWriter struct {
 	data             io.WriteCloser
 	batchInfo        *cdl.BatchInfo
@@ -102,17 +117,27 @@ func (c *CSVItemWriter) Write(item cdl.Item) error {
 	written := 0
 	var r []string
 
-	row := item.NativeItem().(map[string]any)
+	row := cdl.ItemValues(item)
 	c.logger.Debug("Writing CSV item", "columns", len(row))
 	for _, h := range c.config.Columns {
 		if _, ok := row[h]; ok {
 			switch v := row[h].(type) {
 			case float64:
-				r = append(r, strconv.FormatFloat(v, 'f', 0, 64))
+				r = append(r, strconv.FormatFloat(v, 'f', -1, 64))
+			case float32:
+				r = append(r, strconv.FormatFloat(float64(v), 'f', -1, 32))
+			case json.Number:
+				r = append(r, v.String())
+			case *big.Int:
+				r = append(r, v.String())
+			case *big.Float:
+				r = append(r, v.Text('f', -1))
 			case string:
 				r = append(r, v)
 			case bool:
 				r = append(r, strconv.FormatBool(v))
+			case time.Time:
+				r = append(r, v.Format(time.RFC3339Nano))
 			case int:
 				r = append(r, strconv.Itoa(v))
 			case int64:
@@ -156,6 +181,9 @@ type CSVItemIterator struct {
 	decoder *csv.Reader
 	config  *CSVEncoderConfig
 	logger  cdl.Logger
+	schema  cdl.Schema
+	source  string
+	offset  int
 }
 
 func NewCSVItemIterator(sourceConfig map[string]any, logger cdl.Logger, data io.ReadCloser) (*CSVItemIterator, error) {
@@ -166,7 +194,7 @@ func NewCSVItemIterator(sourceConfig map[string]any, logger cdl.Logger, data io.
 	}
 
 	dec := csv.NewReader(data)
-	reader := &CSVItemIterator{data: data, decoder: dec, config: config, logger: logger}
+	reader := &CSVItemIterator{data: data, decoder: dec, config: config, logger: logger, schema: csvSchema(config), source: sourceName(sourceConfig, data)}
 	logger.Info("Created CSV item iterator")
 
 	if config.Separator != "" {
@@ -220,31 +248,21 @@ func (c *CSVItemIterator) Read() (cdl.Item, error) {
 	}
 
 	c.logger.Debug("Read CSV record", "fields", len(entityProps))
-	return &CSVItem{data: entityProps}, nil
+	item := &CSVItem{MapItem: entityProps, itemSource: itemSource{source: c.source, offset: c.offset}, itemSchema: itemSchema{c.schema}}
+	c.offset++
+	return item, nil
 }
 
+// CSVItem is a cdl.MapItem that knows where it was read from and the schema of its source
 type CSVItem struct {
-	data map[string]any
-}
-
-func (item *CSVItem) GetValue(key string) any {
-	return item.data[key]
-}
-
-func (item *CSVItem) SetValue(key string, value any) {
-	item.data[key] = value
+	cdl.MapItem
+	itemSource
+	itemSchema
 }
 
+// GetPropertyNames returns the names in schema order
 func (item *CSVItem) GetPropertyNames() []string {
-	keys := make([]string, 0, len(item.data))
-	for k := range item.data {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-func (item *CSVItem) NativeItem() any {
-	return item.data
+	return item.propertyNames(item.MapItem)
 }
 
 func stringToRune(input string) (rune, error) {
@@ -1,10 +1,15 @@
 package encoder
 
 import (
+	"encoding/json"
 	cdl "github.com/mimiro-io/common-datalayer"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
 	"io/ioutil"
+	"math/big"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCSVRead(t *testing.T) {
@@ -363,3 +368,134 @@ func TestNewCSVConcatenatingWriter(t *testing.T) {
 		t.Errorf("Unexpected combined output:\nExpected:\n%s\nGot:\n%s", expectedOutput, output)
 	}
 }
+
+func TestCSVWriteIsLossless(t *testing.T) {
+	filename := "./testdata/lossless_write.csv"
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	sourceConfig := map[string]any{
+		"separator":  ",",
+		"encoding":   "csv",
+		"columns":    []string{"price", "amount", "counter", "born"},
+		"has_header": false,
+	}
+	logger := cdl.NewLogger("test", "text", "debug")
+	writer, err := NewCSVItemWriter(sourceConfig, logger, file, &cdl.BatchInfo{SyncId: "1", IsStartBatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := NewCSVItemFactory().NewItem()
+	item.SetValue("price", 19.99)
+	item.SetValue("amount", json.Number("1234567890123456.78"))
+	counter, _ := new(big.Int).SetString("18446744073709551616", 10)
+	item.SetValue("counter", counter)
+	item.SetValue("born", time.Date(1956, 5, 12, 22, 30, 0, 0, time.UTC))
+	if err := writer.Write(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "19.99,1234567890123456.78,18446744073709551616,1956-05-12T22:30:00Z\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, string(data))
+	}
+}
+
+func TestCSVReadProvenance(t *testing.T) {
+	file, err := os.Open("./testdata/data.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceConfig := map[string]any{
+		"encoding":   "csv",
+		"columns":    []string{"id", "name", "age", "worksfor"},
+		"has_header": true,
+	}
+	logger := cdl.NewLogger("test", "text", "debug")
+	reader, err := NewCSVItemIterator(sourceConfig, logger, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	mapper := cdl.NewMapper(logger, nil, &cdl.OutgoingMappingConfig{
+		BaseURI:    "http://data.example.com/",
+		Provenance: &cdl.ProvenanceConfig{Source: "source", Offset: "row"},
+		PropertyMappings: []*cdl.ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+		},
+	})
+	for row := 0; row < 3; row++ {
+		item, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity := egdm.NewEntity()
+		if err = mapper.MapItemToEntity(item, entity); err != nil {
+			t.Fatal(err)
+		}
+		if entity.Properties["http://data.example.com/source"] != "./testdata/data.csv" ||
+			entity.Properties["http://data.example.com/row"] != row {
+			t.Errorf("unexpected provenance %v", entity.Properties)
+		}
+	}
+}
+
+func TestCSVItemSchema(t *testing.T) {
+	file, err := os.Open("./testdata/data.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceConfig := map[string]any{
+		"encoding":       "csv",
+		"columns":        []string{"id", "name", "age", "worksfor"},
+		"ignore_columns": []string{"age"},
+		"has_header":     true,
+	}
+	reader, err := NewCSVItemIterator(sourceConfig, cdl.NewLogger("test", "text", "debug"), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	item, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"id", "name", "worksfor"}
+	for i := 0; i < 5; i++ {
+		if names := item.GetPropertyNames(); !reflect.DeepEqual(names, expected) {
+			t.Fatalf("expected names in column order, got %v", names)
+		}
+	}
+
+	// map_named writes the columns of the schema of items from the factory
+	factory, err := NewItemFactory(sourceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper := cdl.NewMapper(cdl.NewLogger("test", "text", "debug"), &cdl.IncomingMappingConfig{
+		BaseURI:  "http://data.example.com/",
+		MapNamed: true,
+	}, nil)
+	entity := egdm.NewEntity().SetID("http://data.example.com/1")
+	entity.Properties["http://data.example.com/name"] = "Homer"
+	entity.Properties["http://data.example.com/worksfor"] = "Plant"
+	entity.Properties["http://data.example.com/age"] = 39
+	written := factory.NewItem()
+	if err = mapper.MapEntityToItem(entity, written); err != nil {
+		t.Fatal(err)
+	}
+	if names := written.GetPropertyNames(); !reflect.DeepEqual(names, []string{"name", "worksfor"}) {
+		t.Errorf("expected schema properties, got %v", names)
+	}
+}
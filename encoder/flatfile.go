@@ -15,10 +15,12 @@ func NewFlatFileItemFactory() ItemFactory {
 	return &FlatFileItemFactory{}
 }
 
-type FlatFileItemFactory struct{}
+type FlatFileItemFactory struct {
+	schema common_datalayer.Schema
+}
 
 func (c *FlatFileItemFactory) NewItem() common_datalayer.Item {
-	return &FlatFileItem{data: make(map[string]any)}
+	return &FlatFileItem{MapItem: common_datalayer.NewMapItem(), itemSchema: itemSchema{c.schema}}
 }
 
 type FlatFileItemWriter struct {
@@ -39,6 +41,30 @@ type FlatFileField struct {
 	NumberPad bool   `json:"number_pad"`
 }
 
+// schema returns the fields that are read as untyped schema
+func (c *FlatFileConfig) schema() common_datalayer.Schema {
+	var schema common_datalayer.Schema
+	for _, field := range c.Fields {
+		if !field.Ignore {
+			schema = append(schema, common_datalayer.SchemaField{Name: field.Name})
+		}
+	}
+	return schema
+}
+
+// flatFileSchema returns the schema of the fields in sourceConfig, nil if it has no fields
+func flatFileSchema(sourceConfig map[string]any) (common_datalayer.Schema, error) {
+	data, err := json.Marshal(sourceConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config FlatFileConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return config.schema(), nil
+}
+
 func NewFlatFileItemWriter(sourceConfig map[string]any, data io.WriteCloser, batchInfo *common_datalayer.BatchInfo) (*FlatFileItemWriter, error) {
 	writer := &FlatFileItemWriter{writer: data, batchInfo: batchInfo}
 	config, err := NewFlatFileWriteConfig(sourceConfig)
@@ -94,7 +120,7 @@ func (c *FlatFileItemWriter) Close() error {
 }
 func (c *FlatFileItemWriter) Write(item common_datalayer.Item) error {
 	buf := new(bytes.Buffer)
-	row := item.NativeItem().(map[string]any)
+	row := common_datalayer.ItemValues(item)
 	line := make([]string, 0)
 	var preppedValue string
 	var fieldValue interface{}
@@ -151,16 +177,20 @@ type FlatFileItemIterator struct {
 	reader  io.ReadCloser
 	scanner *bufio.Scanner
 	config  *FlatFileConfig
+	schema  common_datalayer.Schema
+	source  string
+	offset  int
 }
 
 func NewFlatFileItemIterator(sourceConfig map[string]any, data io.ReadCloser) (*FlatFileItemIterator, error) {
 	scanner := bufio.NewScanner(data)
-	reader := &FlatFileItemIterator{reader: data, scanner: scanner}
+	reader := &FlatFileItemIterator{reader: data, scanner: scanner, source: sourceName(sourceConfig, data)}
 	config, err := NewFlatFileReadConfig(sourceConfig)
 	if err != nil {
 		return nil, err
 	}
 	reader.config = config
+	reader.schema = config.schema()
 	return reader, nil
 }
 
@@ -183,32 +213,22 @@ func (c *FlatFileItemIterator) Read() (common_datalayer.Item, error) {
 				step += field.Length
 			}
 		}
-		return &FlatFileItem{data: entityProps}, nil
+		item := &FlatFileItem{MapItem: entityProps, itemSource: itemSource{source: c.source, offset: c.offset}, itemSchema: itemSchema{c.schema}}
+		c.offset++
+		return item, nil
 	}
 
 	return nil, nil
 }
 
+// FlatFileItem is a common_datalayer.MapItem that knows where it was read from and the schema of its source
 type FlatFileItem struct {
-	data map[string]any
-}
-
-func (item *FlatFileItem) GetValue(key string) any {
-	return item.data[key]
-}
-
-func (item *FlatFileItem) SetValue(key string, value any) {
-	item.data[key] = value
+	common_datalayer.MapItem
+	itemSource
+	itemSchema
 }
 
+// GetPropertyNames returns the names in schema order
 func (item *FlatFileItem) GetPropertyNames() []string {
-	keys := make([]string, 0, len(item.data))
-	for k := range item.data {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-func (item *FlatFileItem) NativeItem() any {
-	return item.data
+	return item.propertyNames(item.MapItem)
 }
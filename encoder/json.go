@@ -15,7 +15,7 @@ func NewJsonItemFactory() ItemFactory {
 type JsonItemFactory struct{}
 
 func (j *JsonItemFactory) NewItem() cdl.Item {
-	return &JsonItem{data: make(map[string]any)}
+	return &JsonItem{MapItem: cdl.NewMapItem()}
 }
 
 type JsonItemWriter struct {
@@ -80,13 +80,15 @@ func (j *JsonItemWriter) Write(item cdl.Item) error {
 	}
 
 	j.logger.Debug("Writing JSON item")
-	return j.encoder.Encode(item.NativeItem())
+	return j.encoder.Encode(cdl.ItemValues(item))
 }
 
 type JsonItemIterator struct {
 	data    io.ReadCloser
 	decoder *json.Decoder
 	logger  cdl.Logger
+	source  string
+	offset  int
 }
 
 func NewJsonItemIterator(sourceConfig map[string]any, logger cdl.Logger, data io.ReadCloser) (*JsonItemIterator, error) {
@@ -97,6 +99,10 @@ func NewJsonItemIterator(sourceConfig map[string]any, logger cdl.Logger, data io
 	// assume 1. for now.
 
 	dec := json.NewDecoder(data)
+	// decode numbers as json.Number to keep all digits, otherwise they are decoded as float64
+	if preserveNumbers, ok := sourceConfig["preserve_numbers"].(bool); ok && preserveNumbers {
+		dec.UseNumber()
+	}
 
 	// check the start is an array token
 	token, err := dec.Token()
@@ -112,7 +118,7 @@ func NewJsonItemIterator(sourceConfig map[string]any, logger cdl.Logger, data io
 
 	logger.Info("Created JSON item iterator")
 
-	return &JsonItemIterator{data: data, decoder: dec, logger: logger}, nil
+	return &JsonItemIterator{data: data, decoder: dec, logger: logger, source: sourceName(sourceConfig, data)}, nil
 }
 
 func (j *JsonItemIterator) Close() error {
@@ -129,33 +135,17 @@ func (j *JsonItemIterator) Read() (cdl.Item, error) {
 		}
 
 		j.logger.Debug("Read JSON object", "fields", len(obj))
-		return &JsonItem{data: obj}, nil
+		item := &JsonItem{MapItem: obj, itemSource: itemSource{source: j.source, offset: j.offset}}
+		j.offset++
+		return item, nil
 	}
 	return nil, nil
 }
 
+// JsonItem is a cdl.MapItem that knows where it was read from
 type JsonItem struct {
-	data map[string]any
-}
-
-func (item *JsonItem) GetValue(key string) any {
-	return item.data[key]
-}
-
-func (item *JsonItem) SetValue(key string, value any) {
-	item.data[key] = value
-}
-
-func (item *JsonItem) GetPropertyNames() []string {
-	keys := make([]string, 0, len(item.data))
-	for k := range item.data {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-func (item *JsonItem) NativeItem() any {
-	return item.data
+	cdl.MapItem
+	itemSource
 }
 
 // JSONConcatenatingWriter implements the ConcatenatingWriter interface for JSON arrays.
@@ -1,8 +1,11 @@
 package encoder
 
 import (
+	"encoding/json"
 	cdl "github.com/mimiro-io/common-datalayer"
+	"io"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -234,3 +237,22 @@ func TestNewJSONConcatenatingWriter(t *testing.T) {
 		t.Errorf("Unexpected combined output:\nExpected:\n%s\nGot:\n%s", expectedOutput, output)
 	}
 }
+
+func TestJsonReadPreservesNumbers(t *testing.T) {
+	data := io.NopCloser(strings.NewReader(`[{"id": 12345678901234567890, "price": 0.1000}]`))
+	logger := cdl.NewLogger("test", "text", "debug")
+	reader, err := NewJsonItemIterator(map[string]any{"preserve_numbers": true}, logger, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.GetValue("id") != json.Number("12345678901234567890") {
+		t.Errorf("expected id as json.Number, got %v (%T)", item.GetValue("id"), item.GetValue("id"))
+	}
+	if item.GetValue("price") != json.Number("0.1000") {
+		t.Errorf("expected price as json.Number, got %v (%T)", item.GetValue("price"), item.GetValue("price"))
+	}
+}
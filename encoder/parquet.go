@@ -10,6 +10,8 @@ import (
 	"github.com/fraugster/parquet-go/parquetschema"
 	cdl "github.com/mimiro-io/common-datalayer"
 	"io"
+	"math"
+	"math/big"
 	"strings"
 	"time"
 )
@@ -18,10 +20,61 @@ func NewParquetItemFactory() ItemFactory {
 	return &ParquetItemFactory{}
 }
 
-type ParquetItemFactory struct{}
+type ParquetItemFactory struct {
+	schema cdl.Schema
+}
 
 func (c *ParquetItemFactory) NewItem() cdl.Item {
-	return &ParquetItem{data: make(map[string]any)}
+	return &ParquetItem{MapItem: cdl.NewMapItem(), itemSchema: itemSchema{c.schema}}
+}
+
+// parquetSchema returns the columns of a parquet schema with the datatypes of the values read from them
+func parquetSchema(def *parquetschema.SchemaDefinition) cdl.Schema {
+	if def == nil || def.RootColumn == nil {
+		return nil
+	}
+	schema := make(cdl.Schema, 0, len(def.RootColumn.Children))
+	for _, column := range def.RootColumn.Children {
+		field := cdl.SchemaField{Name: column.SchemaElement.Name}
+		logicalType := column.SchemaElement.LogicalType
+		switch {
+		case logicalType != nil && (logicalType.IsSetDATE() || logicalType.IsSetTIME()):
+			field.Type = cdl.DatatypeDateTime
+		case logicalType != nil:
+			field.Type = "string"
+		case column.SchemaElement.Type == nil:
+		default:
+			switch *column.SchemaElement.Type {
+			case parquet.Type_BOOLEAN:
+				field.Type = "bool"
+			case parquet.Type_INT32:
+				field.Type = "int"
+			case parquet.Type_INT64:
+				field.Type = "long"
+			case parquet.Type_FLOAT:
+				field.Type = "float"
+			case parquet.Type_DOUBLE:
+				field.Type = "double"
+			}
+		}
+		schema = append(schema, field)
+	}
+	return schema
+}
+
+// parquetItemSchema returns the schema of the parquet schema in sourceConfig, nil if it has none
+func parquetItemSchema(sourceConfig map[string]any) (cdl.Schema, error) {
+	switch def := sourceConfig["schema"].(type) {
+	case string:
+		parsed, err := parquetschema.ParseSchemaDefinition(def)
+		if err != nil {
+			return nil, err
+		}
+		return parquetSchema(parsed), nil
+	case *parquetschema.SchemaDefinition:
+		return parquetSchema(def), nil
+	}
+	return nil, nil
 }
 
 type ParquetEncoderConfig struct {
@@ -109,7 +162,7 @@ func (c *ParquetItemWriter) Close() error {
 }
 
 func (c *ParquetItemWriter) Write(item cdl.Item) error {
-	row := item.NativeItem().(map[string]any)
+	row := cdl.ItemValues(item)
 	for _, h := range c.config.SchemaDef.RootColumn.Children {
 		val, ok := row[h.SchemaElement.Name]
 		if ok && val != nil {
@@ -143,32 +196,41 @@ func convertType(val interface{}, t *parquet.Type, logicalType *parquet.LogicalT
 		return r, nil
 	case parquet.Type_INT32:
 		if logicalType == nil {
-			return int32(val.(int)), nil
+			i, err := int64Of(val)
+			if err != nil {
+				return nil, err
+			}
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return nil, errors.New(fmt.Sprintf("value %v out of range for int32", val))
+			}
+			return int32(i), nil
 		}
 		if logicalType.IsSetDATE() {
-			d := val.(time.Time)
+			d, err := timeOf(val)
+			if err != nil {
+				return nil, err
+			}
 			duration := d.Sub(time.Unix(0, 0))
 			return int32(duration.Hours() / 24), nil
 		}
 		return nil, errors.New(fmt.Sprintf("unsupported logical type for base type %+v: %+v", t, logicalType))
 	case parquet.Type_INT64:
 		if logicalType == nil {
-			switch val.(type) {
-			case float64:
-				return int64(val.(float64)), nil
-			default:
-				return int64(val.(int)), nil
-			}
+			return int64Of(val)
 		}
 		if logicalType.IsSetTIME() {
-			d := val.(time.Time)
+			d, err := timeOf(val)
+			if err != nil {
+				return nil, err
+			}
 			return d.UnixNano(), nil
 		}
 		return nil, errors.New(fmt.Sprintf("unsupported logical type for base type %+v: %+v", t, logicalType))
 	case parquet.Type_FLOAT:
-		return float32(val.(float64)), nil
+		f, err := float64Of(val)
+		return float32(f), err
 	case parquet.Type_DOUBLE:
-		return val.(float64), nil
+		return float64Of(val)
 	case parquet.Type_BYTE_ARRAY:
 		if logicalType == nil {
 			return val.([]byte), nil
@@ -185,6 +247,89 @@ func convertType(val interface{}, t *parquet.Type, logicalType *parquet.LogicalT
 		return nil, errors.New(fmt.Sprintf("unsupported datatype: %+v", t))
 	}
 }
+
+// int64Of accepts all integer types, integral floats, json.Number and *big.Int within the int64 range
+func int64Of(val any) (int64, error) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint:
+		if uint64(v) <= math.MaxInt64 {
+			return int64(v), nil
+		}
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+	case float32:
+		return int64Of(float64(v))
+	case float64:
+		// floats with a fraction are rejected rather than truncated
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), nil
+		}
+	case json.Number:
+		return v.Int64()
+	case *big.Int:
+		if v.IsInt64() {
+			return v.Int64(), nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("could not convert %+v to int64", val))
+}
+
+// float64Of accepts all number types, json.Number and math/big values
+func float64Of(val any) (float64, error) {
+	switch v := val.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	case *big.Float:
+		f, _ := v.Float64()
+		return f, nil
+	}
+	i, err := int64Of(val)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("could not convert %+v to float", val))
+	}
+	return float64(i), nil
+}
+
+// timeOf accepts time.Time and strings in the formats written by the mapper time datatypes
+func timeOf(val any) (time.Time, error) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("could not convert %+v to time", val))
+}
+
 func concatStringSlice(value any) (string, bool) {
 	var output string
 	success := true
@@ -200,6 +345,10 @@ func concatStringSlice(value any) (string, bool) {
 			values = append(values, val.(string))
 		}
 		output = strings.Join(values, ",")
+	case json.Number:
+		output = value.(json.Number).String()
+	case *big.Int:
+		output = value.(*big.Int).String()
 	default:
 		output, success = value.(string)
 	}
@@ -210,6 +359,9 @@ type ParquetItemIterator struct {
 	data   io.ReadCloser // probably don't need this, but can we do something about the readseeker?
 	reader *goparquet.FileReader
 	config *ParquetEncoderConfig
+	schema cdl.Schema
+	source string
+	offset int
 }
 
 func NewParquetItemIterator(sourceConfig map[string]any, data io.ReadCloser) (*ParquetItemIterator, error) {
@@ -225,7 +377,7 @@ func NewParquetItemIterator(sourceConfig map[string]any, data io.ReadCloser) (*P
 	dataBytes, err := io.ReadAll(data)
 	dec, _ := goparquet.NewFileReader(bytes.NewReader(dataBytes), columns...)
 	// don't need data anymore after this
-	reader := &ParquetItemIterator{data: data, reader: dec, config: config}
+	reader := &ParquetItemIterator{data: data, reader: dec, config: config, schema: parquetSchema(config.SchemaDef), source: sourceName(sourceConfig, data)}
 
 	return reader, nil
 }
@@ -245,38 +397,39 @@ func (c *ParquetItemIterator) Read() (cdl.Item, error) {
 	var entityProps = make(map[string]interface{})
 	// needs to convert to correct types based on schema
 	for _, key := range c.config.SchemaDef.RootColumn.Children {
-		if key.SchemaElement.LogicalType != nil {
+		logicalType := key.SchemaElement.LogicalType
+		if logicalType != nil && logicalType.IsSetDATE() {
+			// days since the epoch
+			if days, ok := record[key.SchemaElement.Name].(int32); ok {
+				entityProps[key.SchemaElement.Name] = time.Unix(0, 0).UTC().AddDate(0, 0, int(days))
+			}
+		} else if logicalType != nil && logicalType.IsSetTIME() {
+			// nanoseconds since the epoch, as written by convertType
+			if nanos, ok := record[key.SchemaElement.Name].(int64); ok {
+				entityProps[key.SchemaElement.Name] = time.Unix(0, nanos).UTC()
+			}
+		} else if logicalType != nil {
 			value := fmt.Sprintf("%s", record[key.SchemaElement.Name])
 			entityProps[key.SchemaElement.Name] = value
 		} else {
 			entityProps[key.SchemaElement.Name] = record[key.SchemaElement.Name]
 		}
 	}
-	return &ParquetItem{data: entityProps}, nil
+	item := &ParquetItem{MapItem: entityProps, itemSource: itemSource{source: c.source, offset: c.offset}, itemSchema: itemSchema{c.schema}}
+	c.offset++
+	return item, nil
 }
 
+// ParquetItem is a cdl.MapItem that knows where it was read from and the schema of its source
 type ParquetItem struct {
-	data map[string]any
-}
-
-func (item *ParquetItem) GetValue(key string) any {
-	return item.data[key]
-}
-
-func (item *ParquetItem) SetValue(key string, value any) {
-	item.data[key] = value
+	cdl.MapItem
+	itemSource
+	itemSchema
 }
 
+// GetPropertyNames returns the names in schema order
 func (item *ParquetItem) GetPropertyNames() []string {
-	keys := make([]string, 0, len(item.data))
-	for k := range item.data {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-func (item *ParquetItem) NativeItem() any {
-	return item.data
+	return item.propertyNames(item.MapItem)
 }
 
 // ParquetConcatenatingWriter implements the ConcatenatingWriter interface for Parquet files.
@@ -3,7 +3,9 @@ package encoder
 import (
 	cdl "github.com/mimiro-io/common-datalayer"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParquetRead(t *testing.T) {
@@ -270,3 +272,105 @@ func TestParquetConcatenatingWriter(t *testing.T) {
 		t.Error("Expected no item")
 	}
 }
+
+func TestParquetDateRoundTrip(t *testing.T) {
+	filename := "./testdata/date_write.parquet"
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	sourceConfig := map[string]any{
+		"encoding":        "parquet",
+		"schema":          `message example { required int64 id; optional int32 born (DATE); }`,
+		"flush_threshold": int64(2097152),
+	}
+	writer, err := NewParquetItemWriter(sourceConfig, file, &cdl.BatchInfo{SyncId: "1", IsStartBatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	itemFactory := NewParquetItemFactory()
+	item := itemFactory.NewItem()
+	item.SetValue("id", 1)
+	item.SetValue("born", time.Date(1956, 5, 12, 0, 0, 0, 0, time.UTC))
+	if err := writer.Write(item); err != nil {
+		t.Fatal(err)
+	}
+	item = itemFactory.NewItem()
+	item.SetValue("id", 2)
+	item.SetValue("born", "1987-04-19")
+	if err := writer.Write(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err = os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceConfig["schema"] = `message example { required int64 id; optional int32 born (DATE); }`
+	reader, err := NewParquetItemIterator(sourceConfig, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for _, expected := range []string{"1956-05-12", "1987-04-19"} {
+		item, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		born, ok := item.GetValue("born").(time.Time)
+		if !ok || born.Format(time.DateOnly) != expected {
+			t.Errorf("expected born %s, got %v", expected, item.GetValue("born"))
+		}
+	}
+}
+
+func TestParquetItemSchema(t *testing.T) {
+	file, err := os.Open("./testdata/example.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceConfig := map[string]any{
+		"encoding": "parquet",
+		"schema":   `message example { required int64 id; optional binary name (STRING); optional int64 age; optional binary worksfor (STRING); }`,
+	}
+	factory, err := NewItemFactory(sourceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewParquetItemIterator(sourceConfig, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	item, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cdl.Schema{{Name: "id", Type: "long"}, {Name: "name", Type: "string"}, {Name: "age", Type: "long"}, {Name: "worksfor", Type: "string"}}
+	for _, schemaItem := range []cdl.Item{item, factory.NewItem()} {
+		schema := schemaItem.(cdl.SchemaItem).Schema()
+		if !reflect.DeepEqual(schema, expected) {
+			t.Errorf("expected schema %v, got %v", expected, schema)
+		}
+	}
+	if names := item.GetPropertyNames(); !reflect.DeepEqual(names, []string{"id", "name", "age", "worksfor"}) {
+		t.Errorf("expected names in schema order, got %v", names)
+	}
+}
+
+func TestParquetInt64Of(t *testing.T) {
+	if i, err := int64Of(25.0); err != nil || i != 25 {
+		t.Errorf("expected whole float to convert, got %d %v", i, err)
+	}
+	for _, value := range []any{1.7, float32(-0.5), 1e19} {
+		if i, err := int64Of(value); err == nil {
+			t.Errorf("%v: expected error, got %d", value, i)
+		}
+	}
+}
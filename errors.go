@@ -2,6 +2,7 @@ package common_datalayer
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
 )
@@ -30,8 +31,14 @@ func (l layerError) Underlying() error {
 }
 
 func (l layerError) toHTTPError() *echo.HTTPError {
-	// TODO: map LayerErrorType to HTTP status code and message
-	return echo.NewHTTPError(500, l.err.Error())
+	switch l.errType {
+	case LayerErrorBadParameter:
+		return echo.NewHTTPError(http.StatusBadRequest, l.err.Error())
+	case LayerNotSupported:
+		return echo.NewHTTPError(http.StatusNotImplemented, l.err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, l.err.Error())
+	}
 }
 
 func (l layerError) Error() string {
@@ -0,0 +1,1110 @@
+package common_datalayer
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expressions are used in property constructions to compute new item properties, e.g.
+//
+//	lower(trim(first)) + '-' + id
+//
+// Supported are string ('..' or "..."), number, true, false and null literals, property references
+// (plain names, property paths starting with $ or `quoted names`), the operators
+// + - * / % == != < <= > >= && || ! and ?:, and the functions listed in exprFunctions.
+// Expressions are parsed and type checked once, property values are typed at evaluation time.
+// Null values propagate through operators and most functions, use coalesce to provide fallbacks.
+
+type exprType int
+
+const (
+	exprAny exprType = iota
+	exprString
+	exprNumber
+	exprBool
+	exprTime
+	exprList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprString:
+		return "string"
+	case exprNumber:
+		return "number"
+	case exprBool:
+		return "bool"
+	case exprTime:
+		return "time"
+	case exprList:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+type exprNode interface {
+	eval(item Item) (any, error)
+	kind() exprType
+}
+
+// expression is a compiled expression
+type expression struct {
+	source string
+	root   exprNode
+}
+
+func compileExpression(source string) (*expression, error) {
+	p := &exprParser{source: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected '%s'", tok.text)
+	}
+	return &expression{source: source, root: root}, nil
+}
+
+func (e *expression) eval(item Item) (any, error) {
+	value, err := e.root.eval(item)
+	if err != nil {
+		return nil, fmt.Errorf("expression '%s': %w", e.source, err)
+	}
+	return value, nil
+}
+
+// test evaluates the expression as a condition, null is false
+func (e *expression) test(item Item) (bool, error) {
+	ok, err := evalBool(e.root, item)
+	if err != nil {
+		return false, fmt.Errorf("expression '%s': %w", e.source, err)
+	}
+	return ok, nil
+}
+
+// tokens
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	source string
+	tokens []token
+	next   int
+}
+
+func (p *exprParser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("expression '%s' at position %d: %s", p.source, tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ",", "?", ":"}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '$'
+}
+
+func isIdentPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$' || r == '.'
+}
+
+func (p *exprParser) tokenize() error {
+	s := []rune(p.source)
+	i := 0
+	for i < len(s) {
+		r := s[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(s) && s[i] != r {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteRune(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return p.errorf(token{pos: start}, "unterminated quote")
+			}
+			i++
+			kind := tokString
+			if r == '`' {
+				kind = tokIdent
+			}
+			p.tokens = append(p.tokens, token{kind: kind, text: sb.String(), pos: start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(s) && (unicode.IsDigit(s[i]) || s[i] == '.') {
+				i++
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, text: string(s[start:i]), pos: start})
+		case isIdentStart(r):
+			start := i
+			for i < len(s) {
+				if isIdentPart(s[i]) {
+					i++
+				} else if s[start] == '$' && s[i] == '[' {
+					// path index or quoted key
+					end := i
+					for end < len(s) && s[end] != ']' {
+						end++
+					}
+					if end >= len(s) {
+						return p.errorf(token{pos: i}, "missing ]")
+					}
+					i = end + 1
+				} else if s[start] == '$' && s[i] == '*' {
+					i++
+				} else {
+					break
+				}
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: string(s[start:i]), pos: start})
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(string(s[i:]), op) {
+					p.tokens = append(p.tokens, token{kind: tokOp, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return p.errorf(token{pos: i}, "unexpected character '%c'", r)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEOF, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *exprParser) acceptOp(ops ...string) (token, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return tok, false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next++
+			return tok, true
+		}
+	}
+	return tok, false
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if tok, ok := p.acceptOp(op); !ok {
+		return p.errorf(tok, "expected '%s' but found '%s'", op, tok.text)
+	}
+	return nil
+}
+
+// checkType fails if the static type of node is known and not one of the allowed types
+func (p *exprParser) checkType(tok token, node exprNode, allowed ...exprType) error {
+	if node.kind() == exprAny {
+		return nil
+	}
+	for _, t := range allowed {
+		if node.kind() == t {
+			return nil
+		}
+	}
+	return p.errorf(tok, "'%s' cannot be applied to %s", tok.text, node.kind())
+}
+
+func (p *exprParser) parseTernary() (exprNode, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	tok, ok := p.acceptOp("?")
+	if !ok {
+		return cond, nil
+	}
+	if err := p.checkType(tok, cond, exprBool); err != nil {
+		return nil, err
+	}
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectOp(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return &conditionalNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseLogical("&&", p.parseComparison)
+}
+
+func (p *exprParser) parseLogical(op string, operand func() (exprNode, error)) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.acceptOp(op)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkType(tok, left, exprBool); err != nil {
+			return nil, err
+		}
+		if err := p.checkType(tok, right, exprBool); err != nil {
+			return nil, err
+		}
+		left = &logicalNode{and: op == "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	tok, ok := p.acceptOp("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if tok.text != "==" && tok.text != "!=" {
+		for _, n := range []exprNode{left, right} {
+			if err := p.checkType(tok, n, exprNumber, exprString, exprTime); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if left.kind() != exprAny && right.kind() != exprAny && left.kind() != right.kind() {
+		return nil, p.errorf(tok, "cannot compare %s with %s", left.kind(), right.kind())
+	}
+	return &comparisonNode{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.acceptOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		if tok.text == "+" {
+			for _, n := range []exprNode{left, right} {
+				if err := p.checkType(tok, n, exprNumber, exprString); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			for _, n := range []exprNode{left, right} {
+				if err := p.checkType(tok, n, exprNumber); err != nil {
+					return nil, err
+				}
+			}
+		}
+		left = newArithmeticNode(tok.text, left, right)
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.acceptOp("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range []exprNode{left, right} {
+			if err := p.checkType(tok, n, exprNumber); err != nil {
+				return nil, err
+			}
+		}
+		left = newArithmeticNode(tok.text, left, right)
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	tok, ok := p.acceptOp("!", "-")
+	if !ok {
+		return p.parsePrimary()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if tok.text == "!" {
+		if err := p.checkType(tok, operand, exprBool); err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if err := p.checkType(tok, operand, exprNumber); err != nil {
+		return nil, err
+	}
+	return newArithmeticNode("-", &literalNode{value: int64(0), typ: exprNumber}, operand), nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokNumber:
+		if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return &literalNode{value: i, typ: exprNumber}, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "invalid number '%s'", tok.text)
+		}
+		return &literalNode{value: f, typ: exprNumber}, nil
+	case tokString:
+		return &literalNode{value: tok.text, typ: exprString}, nil
+	case tokIdent:
+		if _, ok := p.acceptOp("("); ok {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{value: tok.text == "true", typ: exprBool}, nil
+		case "null":
+			return &literalNode{value: nil, typ: exprAny}, nil
+		}
+		if isPropertyPath(tok.text) {
+			if _, err := compilePropertyPath(tok.text); err != nil {
+				return nil, p.errorf(tok, "%s", err.Error())
+			}
+		}
+		return &propertyNode{name: tok.text}, nil
+	case tokOp:
+		if tok.text == "(" {
+			node, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+	}
+	return nil, p.errorf(tok, "unexpected '%s'", tok.text)
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	args := make([]exprNode, 0)
+	if _, ok := p.acceptOp(")"); !ok {
+		for {
+			arg, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.acceptOp(","); ok {
+				continue
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	switch name.text {
+	case "if":
+		if len(args) != 3 {
+			return nil, p.errorf(name, "if requires 3 arguments, got %d", len(args))
+		}
+		if err := p.checkType(name, args[0], exprBool); err != nil {
+			return nil, err
+		}
+		return &conditionalNode{cond: args[0], then: args[1], otherwise: args[2]}, nil
+	case "coalesce":
+		if len(args) == 0 {
+			return nil, p.errorf(name, "coalesce requires at least 1 argument")
+		}
+		return &coalesceNode{args: args}, nil
+	}
+
+	fn, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function '%s'", name.text)
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, p.errorf(name, "wrong number of arguments for %s: %d", name.text, len(args))
+	}
+	for i, arg := range args {
+		if err := p.checkType(name, arg, fn.argType(i)); err != nil {
+			return nil, p.errorf(name, "argument %d of %s must be %s, got %s", i+1, name.text, fn.argType(i), arg.kind())
+		}
+	}
+	node := &callNode{name: name.text, fn: fn, args: args}
+	if fn.compile != nil {
+		if err := fn.compile(node); err != nil {
+			return nil, p.errorf(name, "%s", err.Error())
+		}
+	}
+	return node, nil
+}
+
+// nodes
+
+type literalNode struct {
+	value any
+	typ   exprType
+}
+
+func (n *literalNode) eval(Item) (any, error) { return n.value, nil }
+func (n *literalNode) kind() exprType         { return n.typ }
+
+type propertyNode struct {
+	name string
+}
+
+func (n *propertyNode) eval(item Item) (any, error) { return getItemValue(item, n.name) }
+func (n *propertyNode) kind() exprType              { return exprAny }
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) kind() exprType { return exprBool }
+func (n *notNode) eval(item Item) (any, error) {
+	v, err := n.operand.eval(item)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, err := boolOfValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+type logicalNode struct {
+	and         bool
+	left, right exprNode
+}
+
+func (n *logicalNode) kind() exprType { return exprBool }
+func (n *logicalNode) eval(item Item) (any, error) {
+	left, err := evalBool(n.left, item)
+	if err != nil {
+		return nil, err
+	}
+	if n.and && !left {
+		return false, nil
+	}
+	if !n.and && left {
+		return true, nil
+	}
+	return evalBool(n.right, item)
+}
+
+// evalBool evaluates node to a bool, null is false
+func evalBool(node exprNode, item Item) (bool, error) {
+	v, err := node.eval(item)
+	if err != nil || v == nil {
+		return false, err
+	}
+	return boolOfValue(v)
+}
+
+type conditionalNode struct {
+	cond, then, otherwise exprNode
+}
+
+func (n *conditionalNode) kind() exprType {
+	if n.then.kind() == n.otherwise.kind() {
+		return n.then.kind()
+	}
+	return exprAny
+}
+
+func (n *conditionalNode) eval(item Item) (any, error) {
+	cond, err := evalBool(n.cond, item)
+	if err != nil {
+		return nil, err
+	}
+	if cond {
+		return n.then.eval(item)
+	}
+	return n.otherwise.eval(item)
+}
+
+type coalesceNode struct {
+	args []exprNode
+}
+
+func (n *coalesceNode) kind() exprType {
+	t := n.args[0].kind()
+	for _, arg := range n.args[1:] {
+		if arg.kind() != t {
+			return exprAny
+		}
+	}
+	return t
+}
+
+func (n *coalesceNode) eval(item Item) (any, error) {
+	for _, arg := range n.args {
+		v, err := arg.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil && v != "" {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+type comparisonNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *comparisonNode) kind() exprType { return exprBool }
+func (n *comparisonNode) eval(item Item) (any, error) {
+	left, err := n.left.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		switch n.op {
+		case "==":
+			return left == nil && right == nil, nil
+		case "!=":
+			return !(left == nil && right == nil), nil
+		default:
+			return false, nil
+		}
+	}
+	c, err := compareExprValues(left, right)
+	if err != nil {
+		if n.op == "==" || n.op == "!=" {
+			equal := reflect.DeepEqual(left, right)
+			return equal == (n.op == "=="), nil
+		}
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func compareExprValues(left, right any) (int, error) {
+	if lt, ok := left.(time.Time); ok {
+		rt, err := exprTimeOf(right)
+		if err != nil {
+			return 0, err
+		}
+		return lt.Compare(rt), nil
+	}
+	// strings are compared as strings, so '0150' != '150'. Numbers are compared with numbers and
+	// with strings that parse as numbers.
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		return strings.Compare(ls, rs), nil
+	}
+	ln, lerr := exprNumberOf(left)
+	rn, rerr := exprNumberOf(right)
+	if lerr == nil && rerr == nil {
+		li, lint := ln.(int64)
+		ri, rint := rn.(int64)
+		if lint && rint {
+			return cmp.Compare(li, ri), nil
+		}
+		return cmp.Compare(exprFloat(ln), exprFloat(rn)), nil
+	}
+	return 0, fmt.Errorf("cannot compare %v with %v", left, right)
+}
+
+type arithmeticNode struct {
+	op          string
+	left, right exprNode
+	typ         exprType
+}
+
+func newArithmeticNode(op string, left, right exprNode) *arithmeticNode {
+	typ := exprNumber
+	if op == "+" {
+		switch {
+		case left.kind() == exprString || right.kind() == exprString:
+			typ = exprString
+		case left.kind() == exprAny || right.kind() == exprAny:
+			typ = exprAny
+		}
+	}
+	return &arithmeticNode{op: op, left: left, right: right, typ: typ}
+}
+
+func (n *arithmeticNode) kind() exprType { return n.typ }
+func (n *arithmeticNode) eval(item Item) (any, error) {
+	left, err := n.left.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	if n.op == "+" {
+		_, lstr := left.(string)
+		_, rstr := right.(string)
+		if n.typ == exprString || lstr || rstr {
+			ls, err := exprStringOf(left)
+			if err != nil {
+				return nil, err
+			}
+			rs, err := exprStringOf(right)
+			if err != nil {
+				return nil, err
+			}
+			return ls + rs, nil
+		}
+	}
+
+	ln, err := exprNumberOf(left)
+	if err != nil {
+		return nil, err
+	}
+	rn, err := exprNumberOf(right)
+	if err != nil {
+		return nil, err
+	}
+	li, lint := ln.(int64)
+	ri, rint := rn.(int64)
+	if lint && rint && n.op != "/" {
+		switch n.op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("modulo by zero")
+			}
+			return li % ri, nil
+		}
+	}
+	lf, rf := exprFloat(ln), exprFloat(rn)
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "%":
+		return math.Mod(lf, rf), nil
+	default:
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   *exprFunction
+	args []exprNode
+	// state prepared when compiling, e.g. a regular expression
+	compiled any
+}
+
+func (n *callNode) kind() exprType { return n.fn.result }
+func (n *callNode) eval(item Item) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			if n.fn.propagateNull {
+				return nil, nil
+			}
+			continue
+		}
+		args[i], err = exprConvert(v, n.fn.argType(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", n.name, i+1, err)
+		}
+	}
+	result, err := n.fn.call(n, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return result, nil
+}
+
+// value conversion
+
+func exprConvert(v any, t exprType) (any, error) {
+	switch t {
+	case exprString:
+		return exprStringOf(v)
+	case exprNumber:
+		return exprNumberOf(v)
+	case exprBool:
+		return boolOfValue(v)
+	case exprTime:
+		return exprTimeOf(v)
+	default:
+		return v, nil
+	}
+}
+
+func exprStringOf(v any) (string, error) {
+	switch s := v.(type) {
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(s), 'f', -1, 32), nil
+	case time.Time:
+		return s.Format(time.RFC3339), nil
+	}
+	return stringOfValue(v)
+}
+
+// exprNumberOf returns v as int64 or float64
+func exprNumberOf(v any) (any, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint:
+		return exprNumberOf(uint64(n))
+	case uint8:
+		return int64(n), nil
+	case uint16:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		if n > math.MaxInt64 {
+			return float64(n), nil
+		}
+		return int64(n), nil
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case json.Number:
+		return exprNumberOf(string(n))
+	case string:
+		s := strings.TrimSpace(n)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a number", n)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("value %v of type %T is not a number", v, v)
+}
+
+func exprFloat(n any) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
+
+// exprTimeOf accepts time.Time, RFC3339 strings and unix timestamps in seconds
+func exprTimeOf(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339, t)
+	}
+	n, err := exprNumberOf(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("value %v of type %T is not a time", v, v)
+	}
+	return time.Unix(int64(exprFloat(n)), 0).UTC(), nil
+}
+
+// functions
+
+type exprFunction struct {
+	minArgs, maxArgs int // maxArgs -1 means variadic
+	args             []exprType
+	result           exprType
+	// if propagateNull is set the result is null if any argument is null
+	propagateNull bool
+	call          func(n *callNode, args []any) (any, error)
+	// compile is called once after parsing, e.g. to validate and prepare literal arguments
+	compile func(n *callNode) error
+}
+
+// argType returns the type of argument i, the last declared type applies to all following arguments
+func (f *exprFunction) argType(i int) exprType {
+	if len(f.args) == 0 {
+		return exprAny
+	}
+	if i >= len(f.args) {
+		return f.args[len(f.args)-1]
+	}
+	return f.args[i]
+}
+
+func stringFunction(f func(s string) any) *exprFunction {
+	return &exprFunction{minArgs: 1, maxArgs: 1, args: []exprType{exprString}, result: exprString, propagateNull: true,
+		call: func(_ *callNode, args []any) (any, error) { return f(args[0].(string)), nil }}
+}
+
+func numberFunction(f func(x float64) float64) *exprFunction {
+	return &exprFunction{minArgs: 1, maxArgs: 1, args: []exprType{exprNumber}, result: exprNumber, propagateNull: true,
+		call: func(_ *callNode, args []any) (any, error) {
+			if i, ok := args[0].(int64); ok {
+				return int64(f(float64(i))), nil
+			}
+			return f(args[0].(float64)), nil
+		}}
+}
+
+// exprInt converts a number to int64 with round, numbers outside the int64 range, NaN and Inf fail
+func exprInt(n any, round func(x float64) float64) (any, error) {
+	if i, ok := n.(int64); ok {
+		return i, nil
+	}
+	i, err := int64OfFloat(round(n.(float64)))
+	if err != nil {
+		return nil, fmt.Errorf("%v is not an integer in the int64 range", n)
+	}
+	return i, nil
+}
+
+func timePartFunction(f func(t time.Time) int) *exprFunction {
+	return &exprFunction{minArgs: 1, maxArgs: 1, args: []exprType{exprTime}, result: exprNumber, propagateNull: true,
+		call: func(_ *callNode, args []any) (any, error) { return int64(f(args[0].(time.Time))), nil }}
+}
+
+func minMaxFunction(less bool) *exprFunction {
+	return &exprFunction{minArgs: 1, maxArgs: -1, args: []exprType{exprNumber}, result: exprNumber,
+		call: func(_ *callNode, args []any) (any, error) {
+			var result any
+			for _, arg := range args {
+				if arg == nil {
+					continue
+				}
+				if result == nil || (exprFloat(arg) < exprFloat(result)) == less {
+					result = arg
+				}
+			}
+			return result, nil
+		}}
+}
+
+var exprFunctions map[string]*exprFunction
+
+func init() {
+	exprFunctions = map[string]*exprFunction{
+		// string functions
+		"lower": stringFunction(func(s string) any { return strings.ToLower(s) }),
+		"upper": stringFunction(func(s string) any { return strings.ToUpper(s) }),
+		"trim":  stringFunction(func(s string) any { return strings.TrimSpace(s) }),
+		"length": {minArgs: 1, maxArgs: 1, args: []exprType{exprString}, result: exprNumber, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return int64(len([]rune(args[0].(string)))), nil }},
+		"strip": stringFunction(func(s string) any { return stripURL(s) }),
+		"string": {minArgs: 1, maxArgs: 1, args: []exprType{exprString}, result: exprString, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return args[0], nil }},
+		"concat": {minArgs: 1, maxArgs: -1, args: []exprType{exprString}, result: exprString,
+			call: func(_ *callNode, args []any) (any, error) {
+				var sb strings.Builder
+				for _, arg := range args {
+					if arg != nil {
+						sb.WriteString(arg.(string))
+					}
+				}
+				return sb.String(), nil
+			}},
+		"substring": {minArgs: 2, maxArgs: 3, args: []exprType{exprString, exprNumber, exprNumber}, result: exprString, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) {
+				s := []rune(args[0].(string))
+				start := int(exprFloat(args[1]))
+				end := len(s)
+				if len(args) == 3 {
+					end = int(exprFloat(args[2]))
+				}
+				start = max(0, min(start, len(s)))
+				end = max(start, min(end, len(s)))
+				return string(s[start:end]), nil
+			}},
+		"replace": {minArgs: 3, maxArgs: 3, args: []exprType{exprString}, result: exprString, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) {
+				return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+			}},
+		"split": {minArgs: 2, maxArgs: 2, args: []exprType{exprString}, result: exprList, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) {
+				return strings.Split(args[0].(string), args[1].(string)), nil
+			}},
+		"regex": {minArgs: 2, maxArgs: 2, args: []exprType{exprString}, result: exprString, propagateNull: true,
+			compile: func(n *callNode) error {
+				if lit, ok := n.args[1].(*literalNode); ok {
+					pattern, _ := lit.value.(string)
+					re, err := regexp.Compile(pattern)
+					if err != nil {
+						return fmt.Errorf("invalid regex pattern '%s': %w", pattern, err)
+					}
+					n.compiled = re
+				}
+				return nil
+			},
+			call: func(n *callNode, args []any) (any, error) {
+				re, ok := n.compiled.(*regexp.Regexp)
+				if !ok {
+					var err error
+					if re, err = regexp.Compile(args[1].(string)); err != nil {
+						return nil, err
+					}
+				}
+				match := re.FindStringSubmatch(args[0].(string))
+				if match == nil {
+					return nil, nil
+				}
+				// return the first group if there is one
+				if len(match) > 1 {
+					return match[1], nil
+				}
+				return match[0], nil
+			}},
+
+		// math functions
+		"number": {minArgs: 1, maxArgs: 1, args: []exprType{exprNumber}, result: exprNumber, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return args[0], nil }},
+		"int": {minArgs: 1, maxArgs: 1, args: []exprType{exprNumber}, result: exprNumber, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return exprInt(args[0], math.Trunc) }},
+		"abs":   numberFunction(math.Abs),
+		"floor": numberFunction(math.Floor),
+		"ceil":  numberFunction(math.Ceil),
+		"round": {minArgs: 1, maxArgs: 2, args: []exprType{exprNumber}, result: exprNumber, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) {
+				if len(args) == 1 {
+					return exprInt(args[0], math.Round)
+				}
+				factor := math.Pow(10, exprFloat(args[1]))
+				return math.Round(exprFloat(args[0])*factor) / factor, nil
+			}},
+		"min": minMaxFunction(true),
+		"max": minMaxFunction(false),
+
+		// conditional functions, if and coalesce are handled by the parser
+		"is_null": {minArgs: 1, maxArgs: 1, result: exprBool,
+			call: func(_ *callNode, args []any) (any, error) { return args[0] == nil, nil }},
+
+		// date functions, layouts use the go reference time format
+		"now": {minArgs: 0, maxArgs: 0, result: exprTime,
+			call: func(_ *callNode, _ []any) (any, error) { return time.Now().UTC(), nil }},
+		"parse_date": {minArgs: 2, maxArgs: 2, args: []exprType{exprString}, result: exprTime, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return time.Parse(args[1].(string), args[0].(string)) }},
+		"format_date": {minArgs: 2, maxArgs: 2, args: []exprType{exprTime, exprString}, result: exprString, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return args[0].(time.Time).Format(args[1].(string)), nil }},
+		"unix": {minArgs: 1, maxArgs: 1, args: []exprType{exprTime}, result: exprNumber, propagateNull: true,
+			call: func(_ *callNode, args []any) (any, error) { return args[0].(time.Time).Unix(), nil }},
+		"year":  timePartFunction(func(t time.Time) int { return t.Year() }),
+		"month": timePartFunction(func(t time.Time) int { return int(t.Month()) }),
+		"day":   timePartFunction(func(t time.Time) int { return t.Day() }),
+	}
+}
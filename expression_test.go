@@ -0,0 +1,123 @@
+package common_datalayer
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpressionEvaluation(t *testing.T) {
+	item := &InMemoryItem{properties: map[string]any{
+		"first":   "  Homer ",
+		"last":    "Simpson",
+		"id":      42,
+		"price":   2.5,
+		"count":   int64(3),
+		"active":  true,
+		"born":    "1956-05-12T00:00:00Z",
+		"names":   []any{map[string]any{"firstname": "homer"}},
+		"my prop": "spaced",
+		"code":    "0150",
+		"big":     uint64(math.MaxUint64),
+	}}
+
+	tests := []struct {
+		expr     string
+		expected any
+	}{
+		{expr: "lower(trim(first)) + '-' + id", expected: "homer-42"},
+		{expr: "concat(last, ', ', missing, trim(first))", expected: "Simpson, Homer"},
+		{expr: "price * count", expected: 7.5},
+		{expr: "id + count * 2", expected: int64(48)},
+		{expr: "id / 4", expected: 10.5},
+		{expr: "-count % 2", expected: int64(-1)},
+		{expr: "round(price * 1.11, 2)", expected: 2.78},
+		{expr: "round(price) + int(-price) + int(count)", expected: int64(4)},
+		{expr: "max(id, count, 100)", expected: int64(100)},
+		{expr: "active && id > 40 ? 'yes' : 'no'", expected: "yes"},
+		{expr: "if(count >= 4, 'many', 'few')", expected: "few"},
+		{expr: "coalesce(missing, '', last)", expected: "Simpson"},
+		{expr: "upper(missing)", expected: nil},
+		{expr: "missing + 1", expected: nil},
+		{expr: "is_null(missing) && !is_null(last)", expected: true},
+		{expr: "year(born) + 1", expected: int64(1957)},
+		{expr: "format_date(parse_date('12.05.1956', '02.01.2006'), '2006-01-02')", expected: "1956-05-12"},
+		{expr: "substring(last, 1, 3) + length(last)", expected: "im7"},
+		{expr: "regex(last, 'S(im)')", expected: "im"},
+		{expr: "split('a,b', ',')", expected: []string{"a", "b"}},
+		{expr: "$.names[0].firstname + ' ' + `my prop`", expected: "homer spaced"},
+		{expr: "last == 'Simpson' && id != 41 && id == 42.0", expected: true},
+		{expr: "'0150' == '150'", expected: false},
+		{expr: "'1e3' == '1000'", expected: false},
+		{expr: "code == '0150' && code != '150' && code < '9'", expected: true},
+		{expr: "code == 150 && code > 99", expected: true},
+		{expr: "big > id && big > 9223372036854775807", expected: true},
+	}
+
+	for _, test := range tests {
+		expr, err := compileExpression(test.expr)
+		if err != nil {
+			t.Errorf("%s: compile failed: %v", test.expr, err)
+			continue
+		}
+		value, err := expr.eval(item)
+		if err != nil {
+			t.Errorf("%s: eval failed: %v", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", test.expr, test.expected, test.expected, value, value)
+		}
+	}
+
+	expr, _ := compileExpression("now()")
+	value, _ := expr.eval(item)
+	if _, ok := value.(time.Time); !ok {
+		t.Errorf("now() should return time, got %T", value)
+	}
+}
+
+func TestExpressionCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr  string
+		error string
+	}{
+		{expr: "lower(", error: "position 7"},
+		{expr: "first +", error: "unexpected 'end of expression'"},
+		{expr: "unknown(first)", error: "unknown function 'unknown'"},
+		{expr: "lower(1)", error: "argument 1 of lower must be string, got number"},
+		{expr: "trim(first, last)", error: "wrong number of arguments"},
+		{expr: "'a' - 1", error: "'-' cannot be applied to string"},
+		{expr: "1 == 'a'", error: "cannot compare number with string"},
+		{expr: "true + 1", error: "cannot be applied to bool"},
+		{expr: "1 ? 'a' : 'b'", error: "cannot be applied to number"},
+		{expr: "regex(first, '[')", error: "invalid regex pattern"},
+		{expr: "'abc", error: "unterminated quote"},
+		{expr: "first # last", error: "unexpected character '#'"},
+	}
+	for _, test := range tests {
+		_, err := compileExpression(test.expr)
+		if err == nil {
+			t.Errorf("%s: expected error", test.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: expected error containing %q, got %q", test.expr, test.error, err.Error())
+		}
+	}
+}
+
+func TestExpressionEvaluationErrors(t *testing.T) {
+	item := &InMemoryItem{properties: map[string]any{"name": "homer", "zero": 0, "huge": 1e300, "nan": math.NaN(), "inf": math.Inf(-1)}}
+	for _, source := range []string{"name * 2", "1 / zero", "format_date(name, '2006')", "round(huge)", "int(-huge)", "round(nan)", "int(inf)"} {
+		expr, err := compileExpression(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := expr.eval(item); err == nil || !strings.Contains(err.Error(), source) {
+			t.Errorf("%s: expected error referencing expression, got %v", source, err)
+		}
+	}
+}
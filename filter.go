@@ -0,0 +1,100 @@
+package common_datalayer
+
+import (
+	"errors"
+	"fmt"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// actions for items that do not pass the outgoing filter
+const (
+	FilterActionDrop   = "drop"
+	FilterActionDelete = "delete"
+)
+
+// ErrItemFiltered is returned by MapItemToEntity and MapEntityToItem when the mapping filter
+// rejects the item or entity. Callers should skip it and continue with the next one.
+var ErrItemFiltered = errors.New("filtered by mapping config")
+
+// ItemIterator is a source of items, Read returns nil when there are no more items.
+// encoder.ItemIterator implements it.
+type ItemIterator interface {
+	Read() (Item, error)
+	Close() error
+}
+
+// MappingEntityIterator is an EntityIterator that maps the items of an ItemIterator to entities.
+// Items rejected by the mapping filter are skipped, so Next only returns nil when the items are
+// exhausted. Entities linked to an item by inverse references are returned after the entity of
+// the item, see Mapper.MapItemToEntities.
+type MappingEntityIterator struct {
+	mapper  *Mapper
+	items   ItemIterator
+	context *egdm.Context
+	token   func() (*egdm.Continuation, LayerError)
+	pending []*egdm.Entity // linked entities of the last item
+}
+
+func NewMappingEntityIterator(mapper *Mapper, items ItemIterator) *MappingEntityIterator {
+	return &MappingEntityIterator{mapper: mapper, items: items}
+}
+
+// WithContext sets the namespace context returned by Context, the default is the context of the mapper
+func (it *MappingEntityIterator) WithContext(context *egdm.Context) *MappingEntityIterator {
+	it.context = context
+	return it
+}
+
+// WithToken sets the function producing the continuation token returned by Token
+func (it *MappingEntityIterator) WithToken(token func() (*egdm.Continuation, LayerError)) *MappingEntityIterator {
+	it.token = token
+	return it
+}
+
+func (it *MappingEntityIterator) Context() *egdm.Context {
+	if it.context == nil {
+		return it.mapper.Context()
+	}
+	return it.context
+}
+
+func (it *MappingEntityIterator) Next() (*egdm.Entity, LayerError) {
+	if len(it.pending) > 0 {
+		entity := it.pending[0]
+		it.pending = it.pending[1:]
+		return entity, nil
+	}
+	for {
+		item, err := it.items.Read()
+		if err != nil {
+			return nil, Err(fmt.Errorf("could not read item: %w", err), LayerErrorInternal)
+		}
+		if item == nil {
+			return nil, nil
+		}
+		entities, err := it.mapper.MapItemToEntities(item)
+		if errors.Is(err, ErrItemFiltered) {
+			continue
+		}
+		if err != nil {
+			return nil, Err(fmt.Errorf("could not map item to entity: %w", err), LayerErrorInternal)
+		}
+		it.pending = entities[1:]
+		return entities[0], nil
+	}
+}
+
+func (it *MappingEntityIterator) Token() (*egdm.Continuation, LayerError) {
+	if it.token == nil {
+		return nil, nil
+	}
+	return it.token()
+}
+
+func (it *MappingEntityIterator) Close() LayerError {
+	if err := it.items.Close(); err != nil {
+		return Err(fmt.Errorf("could not close item iterator: %w", err), LayerErrorInternal)
+	}
+	return nil
+}
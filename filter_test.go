@@ -0,0 +1,211 @@
+package common_datalayer
+
+import (
+	"errors"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+type sliceItemIterator struct {
+	items  []Item
+	closed bool
+}
+
+func (s *sliceItemIterator) Read() (Item, error) {
+	if len(s.items) == 0 {
+		return nil, nil
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+func (s *sliceItemIterator) Close() error {
+	s.closed = true
+	return nil
+}
+
+func newPerson(id string, age int, status string) Item {
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", id)
+	item.SetValue("age", age)
+	item.SetValue("status", status)
+	return item
+}
+
+func TestMappingEntityIteratorSkipsFilteredItems(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Filter:  "status != 'archived'",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "age", EntityProperty: "age"},
+			{Property: "age", EntityProperty: "adult", Condition: "age >= 18"},
+		},
+	}
+
+	items := &sliceItemIterator{items: []Item{
+		newPerson("1", 39, "active"),
+		newPerson("2", 50, "archived"),
+		newPerson("3", 10, "archived"),
+		newPerson("4", 8, "active"),
+	}}
+	iterator := NewMappingEntityIterator(NewMapper(logger, nil, outgoingConfig), items)
+
+	ids := make([]string, 0)
+	for {
+		entity, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entity == nil {
+			break
+		}
+		ids = append(ids, entity.ID)
+		_, adult := entity.Properties["http://data.example.com/schema/adult"]
+		if adult != (entity.ID == "http://data.example.com/1") {
+			t.Errorf("condition not applied for %s", entity.ID)
+		}
+	}
+	if len(ids) != 2 || ids[0] != "http://data.example.com/1" || ids[1] != "http://data.example.com/4" {
+		t.Errorf("unexpected entities %v", ids)
+	}
+	if err := iterator.Close(); err != nil || !items.closed {
+		t.Errorf("item iterator not closed")
+	}
+}
+
+func TestOutgoingFilterMarksDeleted(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI:      "http://data.example.com/schema/",
+		Filter:       "status != 'archived'",
+		FilterAction: FilterActionDelete,
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+		},
+	}
+	mapper := NewMapper(logger, nil, outgoingConfig)
+
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(newPerson("2", 50, "archived"), entity); err != nil {
+		t.Fatal(err)
+	}
+	if !entity.IsDeleted || entity.ID != "http://data.example.com/2" {
+		t.Errorf("expected deleted entity, got %+v", entity)
+	}
+
+	entity = egdm.NewEntity()
+	if err := mapper.MapItemToEntity(newPerson("1", 39, "active"), entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.IsDeleted {
+		t.Errorf("expected entity not to be deleted")
+	}
+
+	outgoingConfig.FilterAction = "ignore"
+	if err := NewMapper(logger, nil, outgoingConfig).MapItemToEntity(newPerson("1", 39, "active"), egdm.NewEntity()); err == nil {
+		t.Errorf("expected error for invalid filter action")
+	}
+}
+
+func TestIncomingFilterAndConditions(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Filter:  "!`@deleted`",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, StripReferencePrefix: true},
+			{Property: "name", EntityProperty: "name"},
+			{Property: "nickname", EntityProperty: "name", Condition: "length(name) < 5"},
+		},
+	}
+	mapper := NewMapper(logger, incomingConfig, nil)
+
+	entity := egdm.NewEntity().SetID("http://data.example.com/1")
+	entity.SetProperty("http://data.example.com/schema/name", "Homer")
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := mapper.MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+	if item.GetValue("name") != "Homer" || item.GetValue("nickname") != nil {
+		t.Errorf("unexpected item %v", item.properties)
+	}
+
+	entity.IsDeleted = true
+	err := mapper.MapEntityToItem(entity, &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)})
+	if !errors.Is(err, ErrItemFiltered) {
+		t.Errorf("expected filtered error, got %v", err)
+	}
+}
+
+func TestMappingEntityIteratorYieldsLinkedEntities(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/employees/{value}"},
+			{Property: "department", EntityProperty: "worksIn", IsReference: true,
+				URIValuePattern: "http://data.example.com/departments/{value}", InverseEntityProperty: "employs"},
+			{Property: "projects", EntityProperty: "worksOn", IsReference: true, ListFormat: ListFormat{ListSeparator: ","},
+				URIValuePattern: "http://data.example.com/projects/{value}", InverseEntityProperty: "staffedBy"},
+			{Property: "status", IsDeleted: true, Datatype: "bool"},
+		},
+	}
+	employee := func(id string, department string, projects string, deleted bool) Item {
+		item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+		item.SetValue("id", id)
+		item.SetValue("department", department)
+		item.SetValue("projects", projects)
+		item.SetValue("status", deleted)
+		return item
+	}
+	items := &sliceItemIterator{items: []Item{
+		employee("1", "sales", "p1,p2", false),
+		employee("2", "it", "p2", true),
+	}}
+	iterator := NewMappingEntityIterator(NewMapper(logger, nil, outgoingConfig), items)
+
+	entities := make([]*egdm.Entity, 0)
+	for {
+		entity, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entity == nil {
+			break
+		}
+		entities = append(entities, entity)
+	}
+
+	ids := make([]string, len(entities))
+	for i, entity := range entities {
+		ids[i] = entity.ID
+	}
+	expected := []string{
+		"http://data.example.com/employees/1",
+		"http://data.example.com/departments/sales",
+		"http://data.example.com/projects/p1",
+		"http://data.example.com/projects/p2",
+		"http://data.example.com/employees/2",
+	}
+	if len(ids) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, ids)
+		}
+	}
+	if entities[1].References["http://data.example.com/schema/employs"] != "http://data.example.com/employees/1" ||
+		entities[3].References["http://data.example.com/schema/staffedBy"] != "http://data.example.com/employees/1" {
+		t.Errorf("missing inverse references %v, %v", entities[1].References, entities[3].References)
+	}
+
+	outgoingConfig.PropertyMappings[1].IsReference = false
+	if NewMapper(logger, nil, outgoingConfig).Err() == nil {
+		t.Errorf("expected inverse_entity_property without is_reference to be invalid")
+	}
+}
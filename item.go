@@ -0,0 +1,117 @@
+package common_datalayer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MapItem is an Item backed by a map, e.g. a decoded JSON object or a row of named columns. The
+// items of the encoder package are MapItems. GetPropertyNames returns the names sorted.
+type MapItem map[string]any
+
+func NewMapItem() MapItem { return make(MapItem) }
+
+func (m MapItem) GetValue(name string) any        { return m[name] }
+func (m MapItem) SetValue(name string, value any) { m[name] = value }
+func (m MapItem) NativeItem() any                 { return map[string]any(m) }
+func (m MapItem) GetPropertyNames() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ItemValues returns the values of item by property name. Items backed by a map[string]any, like
+// MapItem, return their map, other items a new map of the values of GetPropertyNames.
+func ItemValues(item Item) map[string]any {
+	if values, ok := item.NativeItem().(map[string]any); ok {
+		return values
+	}
+	names := item.GetPropertyNames()
+	values := make(map[string]any, len(names))
+	for _, name := range names {
+		values[name] = item.GetValue(name)
+	}
+	return values
+}
+
+// ErrNoValue is returned by the typed accessors, wrapped in a ConversionError, if the item has no
+// value for the property
+var ErrNoValue = errors.New("no value")
+
+// ConversionError is returned by the typed accessors and StructItem if a value cannot be
+// converted to the requested type
+type ConversionError struct {
+	Property string
+	Value    any
+	Type     string
+	Err      error
+}
+
+func (e *ConversionError) Error() string {
+	if errors.Is(e.Err, ErrNoValue) {
+		return fmt.Sprintf("property %s: %s", e.Property, e.Err)
+	}
+	return fmt.Sprintf("property %s: cannot convert %v (%T) to %s: %s", e.Property, e.Value, e.Value, e.Type, e.Err)
+}
+
+func (e *ConversionError) Unwrap() error { return e.Err }
+
+// typedValue reads the property name, which can be a property path, and converts it with convert
+func typedValue[T any](item Item, name string, typeName string, convert func(any) (T, error)) (T, error) {
+	var zero T
+	value, err := getItemValue(item, name)
+	if err != nil {
+		return zero, &ConversionError{Property: name, Type: typeName, Err: err}
+	}
+	if value == nil {
+		return zero, &ConversionError{Property: name, Type: typeName, Err: ErrNoValue}
+	}
+	result, err := convert(value)
+	if err != nil {
+		return zero, &ConversionError{Property: name, Value: value, Type: typeName, Err: err}
+	}
+	return result, nil
+}
+
+// GetString returns the value of the property as string, numbers and bools are formatted
+func GetString(item Item, name string) (string, error) {
+	return typedValue(item, name, "string", stringOfValue)
+}
+
+// GetInt returns the value of the property as int, strings are parsed
+func GetInt(item Item, name string) (int, error) {
+	return typedValue(item, name, "int", func(value any) (int, error) {
+		i, err := int64OfValue(value)
+		if err != nil {
+			return 0, err
+		}
+		if i < math.MinInt || i > math.MaxInt {
+			return 0, errors.New("value out of range")
+		}
+		return int(i), nil
+	})
+}
+
+// GetFloat returns the value of the property as float64, strings are parsed
+func GetFloat(item Item, name string) (float64, error) {
+	return typedValue(item, name, "float64", float64OfValue)
+}
+
+// GetBool returns the value of the property as bool, strings are parsed with strconv.ParseBool
+func GetBool(item Item, name string) (bool, error) {
+	return typedValue(item, name, "bool", boolOfValue)
+}
+
+// GetTime returns the value of the property as time.Time. Strings are parsed with the default
+// layouts of the time datatypes and numbers are seconds since the unix epoch.
+func GetTime(item Item, name string) (time.Time, error) {
+	return typedValue(item, name, "time.Time", func(value any) (time.Time, error) {
+		return timeOfValue(value, "", time.UTC, 0)
+	})
+}
@@ -0,0 +1,61 @@
+package common_datalayer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTypedAccessors(t *testing.T) {
+	item := MapItem{
+		"name":    "Homer",
+		"age":     "39",
+		"height":  1.83,
+		"active":  "true",
+		"born":    "1956-05-12",
+		"address": map[string]any{"zip": 12345},
+	}
+	if s, err := GetString(item, "$.address.zip"); err != nil || s != "12345" {
+		t.Errorf("GetString: %v, %v", s, err)
+	}
+	if i, err := GetInt(item, "age"); err != nil || i != 39 {
+		t.Errorf("GetInt: %v, %v", i, err)
+	}
+	if f, err := GetFloat(item, "height"); err != nil || f != 1.83 {
+		t.Errorf("GetFloat: %v, %v", f, err)
+	}
+	if b, err := GetBool(item, "active"); err != nil || !b {
+		t.Errorf("GetBool: %v, %v", b, err)
+	}
+	if born, err := GetTime(item, "born"); err != nil || !born.Equal(time.Date(1956, 5, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("GetTime: %v, %v", born, err)
+	}
+
+	_, err := GetInt(item, "name")
+	var conversionErr *ConversionError
+	if !errors.As(err, &conversionErr) || conversionErr.Property != "name" || conversionErr.Type != "int" {
+		t.Errorf("expected conversion error, got %v", err)
+	}
+	if _, err = GetInt(item, "height"); err == nil {
+		t.Error("GetInt should not truncate 1.83")
+	}
+	if _, err = GetTime(item, "missing"); !errors.Is(err, ErrNoValue) || err.Error() != "property missing: no value" {
+		t.Errorf("expected no value error, got %v", err)
+	}
+}
+
+func TestItemValues(t *testing.T) {
+	item := MapItem{"name": "Homer"}
+	values := ItemValues(item)
+	values["age"] = 39
+	if item["age"] != 39 {
+		t.Errorf("expected the map of the item")
+	}
+	person := &struct {
+		Name string `cdl:"name"`
+	}{"Homer"}
+	structItem, _ := NewStructItem(person)
+	if values = ItemValues(structItem); len(values) != 1 || values["name"] != "Homer" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
@@ -0,0 +1,73 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ListFormat controls how multi valued properties are mapped. Lists are always converted and
+// turned into references element by element, these options make single values and delimited
+// strings lists as well.
+//
+// IsList makes single values one element lists. ListSeparator splits delimited strings into
+// lists in outgoing mappings, e.g. a csv column "a;b", and joins lists into delimited strings in
+// incoming mappings.
+type ListFormat struct {
+	IsList        bool   `json:"is_list"`
+	ListSeparator string `json:"list_separator"`
+}
+
+func (f ListFormat) enabled() bool {
+	return f.IsList || f.ListSeparator != ""
+}
+
+// split returns a copy of the elements of value if value is a list, the parts of a delimited
+// string if a separator is configured, or value as only element if IsList is set
+func (f ListFormat) split(value any) ([]any, bool) {
+	if list, ok := asList(value); ok {
+		return append(make([]any, 0, len(list)), list...), true
+	}
+	if s, ok := value.(string); ok && f.ListSeparator != "" {
+		values := make([]any, 0)
+		for _, part := range strings.Split(s, f.ListSeparator) {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+		return values, true
+	}
+	if f.IsList {
+		return []any{value}, true
+	}
+	return nil, false
+}
+
+// elements is like split, but leaves strings intact
+func (f ListFormat) elements(value any) ([]any, bool) {
+	return ListFormat{IsList: f.IsList}.split(value)
+}
+
+// join formats the values as a delimited string
+func (f ListFormat) join(values []any) (string, error) {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		s, err := stringOfValue(v)
+		if err != nil {
+			return "", fmt.Errorf("list element %d: %w", i, err)
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, f.ListSeparator), nil
+}
+
+// convertValues converts all values in place
+func convertValues(convert converter, values []any) error {
+	for i, v := range values {
+		converted, err := convert(v)
+		if err != nil {
+			return fmt.Errorf("list element %d: %w", i, err)
+		}
+		values[i] = converted
+	}
+	return nil
+}
@@ -121,6 +121,8 @@ func NewLogger(serviceName string, format string, level string) Logger {
 		slevel = zerolog.WarnLevel
 	case "error":
 		slevel = zerolog.ErrorLevel
+	case "none":
+		slevel = zerolog.Disabled
 	default:
 		slevel = zerolog.InfoLevel
 	}
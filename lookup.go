@@ -0,0 +1,406 @@
+package common_datalayer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// miss policies for lookup tables
+const (
+	LookupMissKeep    = "keep"
+	LookupMissDefault = "default"
+	LookupMissFail    = "fail"
+)
+
+const defaultLookupCacheSize = 10000
+
+// LookupDefinition declares a named lookup table used by lookup constructions. The entries are given
+// inline in values, read from a csv or json file, or resolved by the LookupProvider registered under
+// the provider name.
+type LookupDefinition struct {
+	Name         string         `json:"name"`
+	Values       map[string]any `json:"values"`
+	File         string         `json:"file"`         // .csv or .json file, relative to the config folder
+	KeyColumn    string         `json:"key_column"`   // defaults to the first csv column
+	ValueColumn  string         `json:"value_column"` // defaults to the second csv column
+	Provider     string         `json:"provider"`
+	OnMiss       string         `json:"on_miss"` // keep (default), default or fail
+	DefaultValue any            `json:"default_value"`
+	CacheSize    int            `json:"cache_size"` // max cached provider results, defaults to 10000
+}
+
+// LookupProvider resolves keys of lookup tables that are not held in memory, e.g. code tables in the
+// source system. found is false if the table has no entry for the key. Results are cached until the
+// lookup tables are reloaded.
+type LookupProvider interface {
+	Lookup(table string, key string) (value any, found bool, err error)
+}
+
+type lookupResult struct {
+	value any
+	found bool
+}
+
+type lookupTable struct {
+	definition *LookupDefinition
+	configPath string
+	path       string
+	modTime    time.Time
+	values     map[string]any
+	inverse    map[string]string
+
+	cacheLock sync.Mutex
+	cache     map[string]lookupResult
+}
+
+// LookupTables holds the lookup tables of a config and the providers registered by the layer. The
+// tables of the config a layer is created with are available from Config.LookupTables, and are
+// passed to mappers with NewMapperWithLookups. The config updater reloads them in place, so
+// mappers and providers keep working with the updated tables.
+type LookupTables struct {
+	lock      sync.RWMutex
+	tables    map[string]*lookupTable
+	providers map[string]LookupProvider
+}
+
+func NewLookupTables() *LookupTables {
+	return &LookupTables{
+		tables:    make(map[string]*lookupTable),
+		providers: make(map[string]LookupProvider),
+	}
+}
+
+// RegisterProvider makes provider available to lookup tables declared with the given provider name
+func (r *LookupTables) RegisterProvider(name string, provider LookupProvider) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.providers[name] = provider
+}
+
+// LoadLookupTables loads the lookup tables declared in config into the tables of config, creating
+// them on first use. The service runner calls this on startup and the config updater on every
+// config change, layers that do not use the service runner call it themselves.
+func LoadLookupTables(config *Config) error {
+	if config.lookupTables == nil {
+		config.lookupTables = NewLookupTables()
+	}
+	return config.lookupTables.Load(config)
+}
+
+// Load replaces the tables with the ones declared in config
+func (r *LookupTables) Load(config *Config) error {
+	tables := make(map[string]*lookupTable)
+	for _, def := range config.Lookups {
+		if def.Name == "" {
+			return fmt.Errorf("lookup table without name")
+		}
+		if _, ok := tables[def.Name]; ok {
+			return fmt.Errorf("lookup table '%s' is declared more than once", def.Name)
+		}
+		table, err := newLookupTable(def, config.ConfigPath)
+		if err != nil {
+			return err
+		}
+		tables[def.Name] = table
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.tables = tables
+	return nil
+}
+
+// refresh reloads file based tables whose file has changed since they were loaded
+func (r *LookupTables) refresh(logger Logger) {
+	if r == nil {
+		return
+	}
+	r.lock.RLock()
+	changed := make([]*lookupTable, 0)
+	for _, table := range r.tables {
+		if table.path == "" {
+			continue
+		}
+		if info, err := os.Stat(table.path); err == nil && !info.ModTime().Equal(table.modTime) {
+			changed = append(changed, table)
+		}
+	}
+	r.lock.RUnlock()
+
+	for _, table := range changed {
+		reloaded, err := newLookupTable(table.definition, table.configPath)
+		if err != nil {
+			logger.Error("Failed to reload lookup table", "table", table.definition.Name, "error", err.Error())
+			continue
+		}
+		logger.Info("Reloaded lookup table", "table", table.definition.Name, "file", table.path)
+		r.lock.Lock()
+		if r.tables[table.definition.Name] == table {
+			r.tables[table.definition.Name] = reloaded
+		}
+		r.lock.Unlock()
+	}
+}
+
+// has returns true if r has a table with the given name
+func (r *LookupTables) has(name string) bool {
+	if r == nil {
+		return false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.tables[name]
+	return ok
+}
+
+func (r *LookupTables) table(name string) (*lookupTable, LookupProvider, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	table, ok := r.tables[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown lookup table '%s'", name)
+	}
+	if table.definition.Provider == "" {
+		return table, nil, nil
+	}
+	provider, ok := r.providers[table.definition.Provider]
+	if !ok {
+		return nil, nil, fmt.Errorf("lookup table '%s' uses unregistered provider '%s'", name, table.definition.Provider)
+	}
+	return table, provider, nil
+}
+
+func newLookupTable(def *LookupDefinition, configPath string) (*lookupTable, error) {
+	switch def.OnMiss {
+	case "", LookupMissKeep, LookupMissDefault, LookupMissFail:
+	default:
+		return nil, fmt.Errorf("lookup table '%s' has invalid on_miss '%s', expected keep, default or fail", def.Name, def.OnMiss)
+	}
+
+	sources := 0
+	for _, set := range []bool{def.Values != nil, def.File != "", def.Provider != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("lookup table '%s' must have exactly one of values, file or provider", def.Name)
+	}
+
+	table := &lookupTable{definition: def, configPath: configPath, values: def.Values, cache: make(map[string]lookupResult)}
+	if def.File != "" {
+		table.path = def.File
+		if !filepath.IsAbs(table.path) && configPath != "" {
+			table.path = filepath.Join(configPath, table.path)
+		}
+		info, err := os.Stat(table.path)
+		if err != nil {
+			return nil, fmt.Errorf("lookup table '%s': %w", def.Name, err)
+		}
+		table.modTime = info.ModTime()
+		table.values, err = readLookupFile(table.path, def)
+		if err != nil {
+			return nil, fmt.Errorf("lookup table '%s': %w", def.Name, err)
+		}
+	}
+
+	if table.values != nil {
+		// the inverse maps values back to keys, the first key in sort order wins for duplicate values
+		keys := make([]string, 0, len(table.values))
+		for key := range table.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		table.inverse = make(map[string]string, len(keys))
+		for _, key := range keys {
+			value, err := stringOfValue(table.values[key])
+			if err != nil {
+				continue
+			}
+			if _, ok := table.inverse[value]; !ok {
+				table.inverse[value] = key
+			}
+		}
+	}
+	return table, nil
+}
+
+// readLookupFile reads a csv file with a header row, a json object or a json array of objects
+func readLookupFile(path string, def *LookupDefinition) (map[string]any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readLookupCSV(file, def)
+	case ".json":
+		return readLookupJSON(file, def)
+	}
+	return nil, fmt.Errorf("unsupported lookup file '%s', expected .csv or .json", path)
+}
+
+func readLookupCSV(r io.Reader, def *LookupDefinition) (map[string]any, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("csv file has no header row")
+	}
+	if len(rows[0]) < 2 {
+		return nil, fmt.Errorf("csv file needs a key and a value column")
+	}
+	keyIndex, err := csvColumnIndex(rows[0], def.KeyColumn, 0)
+	if err != nil {
+		return nil, err
+	}
+	valueIndex, err := csvColumnIndex(rows[0], def.ValueColumn, 1)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(rows)-1)
+	for _, row := range rows[1:] {
+		values[row[keyIndex]] = row[valueIndex]
+	}
+	return values, nil
+}
+
+// csvColumnIndex returns the index of column in header, or defaultIndex if column is empty
+func csvColumnIndex(header []string, column string, defaultIndex int) (int, error) {
+	if column == "" {
+		return defaultIndex, nil
+	}
+	for i, name := range header {
+		if name == column {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("csv file has no column '%s'", column)
+}
+
+func readLookupJSON(r io.Reader, def *LookupDefinition) (map[string]any, error) {
+	var data any
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+	switch v := data.(type) {
+	case map[string]any:
+		return v, nil
+	case []any:
+		if def.KeyColumn == "" || def.ValueColumn == "" {
+			return nil, fmt.Errorf("key_column and value_column are required for json arrays")
+		}
+		values := make(map[string]any, len(v))
+		for _, element := range v {
+			row, ok := element.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("json array must contain objects")
+			}
+			key, err := stringOfValue(row[def.KeyColumn])
+			if err != nil {
+				return nil, err
+			}
+			values[key] = row[def.ValueColumn]
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("json file must contain an object or an array of objects")
+}
+
+// get looks up a single key, using the provider and its cache for provider tables
+func (t *lookupTable) get(key string, provider LookupProvider, reverse bool) (any, bool, error) {
+	if provider == nil {
+		if reverse {
+			value, ok := t.inverse[key]
+			return value, ok, nil
+		}
+		value, ok := t.values[key]
+		return value, ok, nil
+	}
+	if reverse {
+		return nil, false, fmt.Errorf("reverse lookup is not supported for provider table '%s'", t.definition.Name)
+	}
+
+	t.cacheLock.Lock()
+	result, ok := t.cache[key]
+	t.cacheLock.Unlock()
+	if ok {
+		return result.value, result.found, nil
+	}
+	value, found, err := provider.Lookup(t.definition.Name, key)
+	if err != nil {
+		return nil, false, fmt.Errorf("lookup table '%s': %w", t.definition.Name, err)
+	}
+	size := t.definition.CacheSize
+	if size == 0 {
+		size = defaultLookupCacheSize
+	}
+	t.cacheLock.Lock()
+	if len(t.cache) >= size {
+		t.cache = make(map[string]lookupResult)
+	}
+	t.cache[key] = lookupResult{value: value, found: found}
+	t.cacheLock.Unlock()
+	return value, found, nil
+}
+
+// resolve looks up value, or each element if value is a list, and applies the miss policy
+func (t *lookupTable) resolve(value any, provider LookupProvider, reverse bool) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if list, ok := asList(value); ok {
+		results := make([]any, len(list))
+		for i, v := range list {
+			result, err := t.resolve(v, provider, reverse)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = result
+		}
+		return results, nil
+	}
+
+	key, err := stringOfValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("lookup table '%s': invalid key: %w", t.definition.Name, err)
+	}
+	result, found, err := t.get(key, provider, reverse)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return result, nil
+	}
+	switch t.definition.OnMiss {
+	case LookupMissDefault:
+		return t.definition.DefaultValue, nil
+	case LookupMissFail:
+		return nil, fmt.Errorf("lookup table '%s' has no entry for '%s'", t.definition.Name, key)
+	}
+	return value, nil
+}
+
+// lookup resolves the value of property p1 in the named lookup table
+func (r *LookupTables) lookup(item Item, tableName string, p1 string, reverse bool) (any, error) {
+	table, provider, err := r.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	value, err := getItemValue(item, p1)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: property '%s' could not be accessed. item: %+v, error: %w", p1, item.NativeItem(), err)
+	}
+	return table.resolve(value, provider, reverse)
+}
@@ -0,0 +1,200 @@
+package common_datalayer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+type countingLookupProvider struct {
+	calls int
+}
+
+func (p *countingLookupProvider) Lookup(table string, key string) (any, bool, error) {
+	p.calls++
+	if key == "NO" {
+		return "Norway", true, nil
+	}
+	return nil, false, nil
+}
+
+func TestLookupConstructions(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	config := &Config{Lookups: []*LookupDefinition{
+		{Name: "countryUris", Values: map[string]any{"NO": "http://data.example.com/countries/norway"}},
+		{Name: "countryNames", Provider: "countries", OnMiss: LookupMissDefault, DefaultValue: "Unknown"},
+		{Name: "strict", Values: map[string]any{"a": 1}, OnMiss: LookupMissFail},
+	}}
+	if err := LoadLookupTables(config); err != nil {
+		t.Fatal(err)
+	}
+	lookups := config.LookupTables()
+	provider := &countingLookupProvider{}
+	lookups.RegisterProvider("countries", provider)
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Constructions: []*PropertyConstructor{
+			{PropertyName: "countryUri", Operation: "lookup", Arguments: []string{"countryUris", "country"}},
+			{PropertyName: "countryName", Operation: "lookup", Arguments: []string{"countryNames", "country"}},
+			{PropertyName: "visitedNames", Operation: "lookup", Arguments: []string{"countryNames", "visited"}},
+			{PropertyName: "unmapped", Operation: "lookup", Arguments: []string{"countryUris", "visited"}},
+		},
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "countryUri", EntityProperty: "country", IsReference: true, URIValuePattern: "{value}"},
+			{Property: "countryName", EntityProperty: "countryName"},
+			{Property: "visitedNames", EntityProperty: "visited"},
+			{Property: "unmapped", EntityProperty: "unmapped"},
+		},
+	}
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "1")
+	item.SetValue("country", "NO")
+	item.SetValue("visited", []string{"NO", "SE"})
+
+	mapper := NewMapperWithLookups(logger, lookups, nil, outgoingConfig)
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.References["http://data.example.com/schema/country"] != "http://data.example.com/countries/norway" {
+		t.Errorf("unexpected country reference %v", entity.References["http://data.example.com/schema/country"])
+	}
+	if entity.Properties["http://data.example.com/schema/countryName"] != "Norway" {
+		t.Errorf("unexpected country name %v", entity.Properties["http://data.example.com/schema/countryName"])
+	}
+	if !reflect.DeepEqual(entity.Properties["http://data.example.com/schema/visited"], []any{"Norway", "Unknown"}) {
+		t.Errorf("unexpected visited %v", entity.Properties["http://data.example.com/schema/visited"])
+	}
+	// misses are kept by default
+	if !reflect.DeepEqual(entity.Properties["http://data.example.com/schema/unmapped"], []any{"http://data.example.com/countries/norway", "SE"}) {
+		t.Errorf("unexpected unmapped %v", entity.Properties["http://data.example.com/schema/unmapped"])
+	}
+	// provider results are cached
+	if provider.calls != 2 {
+		t.Errorf("expected 2 provider calls, got %d", provider.calls)
+	}
+
+	// fail on miss
+	failConfig := &OutgoingMappingConfig{
+		BaseURI:       "http://data.example.com/schema/",
+		Constructions: []*PropertyConstructor{{PropertyName: "x", Operation: "lookup", Arguments: []string{"strict", "country"}}},
+	}
+	err := NewMapperWithLookups(logger, lookups, nil, failConfig).MapItemToEntity(item, egdm.NewEntity())
+	if err == nil || !strings.Contains(err.Error(), "lookup table 'strict' has no entry for 'NO'") {
+		t.Errorf("expected lookup miss error, got %v", err)
+	}
+
+	// incoming reverse lookup
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Constructions: []*PropertyConstructor{
+			{PropertyName: "country", Operation: "reverse_lookup", Arguments: []string{"countryUris", "country"}},
+		},
+	}
+	incoming := egdm.NewEntity().SetID("http://data.example.com/1")
+	incoming.SetReference("http://data.example.com/schema/country", "http://data.example.com/countries/norway")
+	result := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := NewMapperWithLookups(logger, lookups, incomingConfig, nil).MapEntityToItem(incoming, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.GetValue("country") != "NO" {
+		t.Errorf("expected country NO, got %v", result.GetValue("country"))
+	}
+}
+
+func TestLookupTableFiles(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "countries.csv")
+	if err := os.WriteFile(csvFile, []byte("name,code,label\nNorway,NO,Norge\nSweden,SE,Sverige\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "countries.json"), []byte(`[{"code":"NO","id":1},{"code":"SE","id":2}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{ConfigPath: dir, Lookups: []*LookupDefinition{
+		{Name: "labels", File: "countries.csv", KeyColumn: "code", ValueColumn: "label"},
+		{Name: "ids", File: "countries.json", KeyColumn: "code", ValueColumn: "id"},
+	}}
+	if err := LoadLookupTables(config); err != nil {
+		t.Fatal(err)
+	}
+	lookups := config.LookupTables()
+
+	item := &InMemoryItem{properties: map[string]any{"country": "SE"}}
+	for table, expected := range map[string]any{"labels": "Sverige", "ids": float64(2)} {
+		value, err := lookups.lookup(item, table, "country", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Errorf("%s: expected %v, got %v", table, expected, value)
+		}
+	}
+
+	// changed files are reloaded by the config updater
+	if err := os.WriteFile(csvFile, []byte("code,label\nSE,Svezia\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(csvFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	lookups.refresh(logger)
+	value, err := lookups.lookup(item, "labels", "country", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "Svezia" {
+		t.Errorf("expected reloaded label, got %v", value)
+	}
+
+	if err := LoadLookupTables(&Config{Lookups: []*LookupDefinition{{Name: "bad", OnMiss: "ignore", Values: map[string]any{}}}}); err == nil {
+		t.Errorf("expected error for invalid on_miss")
+	}
+	missing := &Config{ConfigPath: dir, Lookups: []*LookupDefinition{{Name: "labels", File: "countries.csv", KeyColumn: "iso"}}}
+	if err := LoadLookupTables(missing); err == nil || !strings.Contains(err.Error(), "csv file has no column 'iso'") {
+		t.Errorf("expected error for missing key column, got %v", err)
+	}
+}
+
+func TestLookupTableNamesAreCompiled(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	config := &Config{Lookups: []*LookupDefinition{{Name: "countries", Values: map[string]any{"NO": "Norway"}}}}
+	if err := LoadLookupTables(config); err != nil {
+		t.Fatal(err)
+	}
+	outgoing := func(table string) *OutgoingMappingConfig {
+		return &OutgoingMappingConfig{
+			BaseURI:       "http://data.example.com/schema/",
+			Constructions: []*PropertyConstructor{{PropertyName: "name", Operation: "lookup", Arguments: []string{table, "country"}}},
+		}
+	}
+	if err := NewMapperWithLookups(logger, config.LookupTables(), nil, outgoing("countries")).Err(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	err := NewMapperWithLookups(logger, config.LookupTables(), nil, outgoing("contries")).Err()
+	if err == nil || !strings.Contains(err.Error(), "unknown lookup table 'contries'") {
+		t.Errorf("expected unknown table error, got %v", err)
+	}
+	if err = NewMapper(logger, nil, outgoing("countries")).Err(); err == nil {
+		t.Errorf("expected unknown table error without lookup tables")
+	}
+
+	// the tables of other configs are separate
+	other := &Config{}
+	if err = LoadLookupTables(other); err != nil {
+		t.Fatal(err)
+	}
+	if other.LookupTables().has("countries") {
+		t.Errorf("expected tables of configs to be separate")
+	}
+}
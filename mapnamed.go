@@ -0,0 +1,224 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// map_named_case values
+const (
+	NameCaseCamel = "camel"
+	NameCaseSnake = "snake"
+)
+
+// map_named_collision values
+const (
+	CollisionFirst  = "first"
+	CollisionError  = "error"
+	CollisionSuffix = "suffix"
+)
+
+// With map_named the properties and references of an entity under the base uri are mapped to
+// item properties named by their local names. Items with a schema get the properties of their
+// schema, items with property names get those properties, and empty items, e.g. from an
+// ItemFactory, get all of them except the entity properties of the property mappings.
+
+// namedPlan is the compiled map_named part of an IncomingMappingConfig
+type namedPlan struct {
+	baseURI   string
+	rename    func(string) string // nil keeps the local names
+	include   map[string]bool     // nil includes all names
+	exclude   map[string]bool
+	collision string
+	mapped    map[string]bool // entity properties of the property mappings
+}
+
+type namedValue struct {
+	name  string
+	value any
+}
+
+func compileNamed(config *IncomingMappingConfig, mappings []*incomingMapping) (*namedPlan, error) {
+	plan := &namedPlan{baseURI: config.BaseURI, collision: config.MapNamedCollision, mapped: make(map[string]bool)}
+	switch config.MapNamedCase {
+	case "":
+	case NameCaseCamel:
+		plan.rename = toCamelCase
+	case NameCaseSnake:
+		plan.rename = toSnakeCase
+	default:
+		return nil, fmt.Errorf("map_named_case '%s' is invalid, expected camel or snake", config.MapNamedCase)
+	}
+	switch config.MapNamedCollision {
+	case "":
+		plan.collision = CollisionFirst
+	case CollisionFirst, CollisionError, CollisionSuffix:
+	default:
+		return nil, fmt.Errorf("map_named_collision '%s' is invalid, expected first, error or suffix", config.MapNamedCollision)
+	}
+	if len(config.MapNamedInclude) > 0 {
+		plan.include = make(map[string]bool, len(config.MapNamedInclude))
+		for _, name := range config.MapNamedInclude {
+			plan.include[name] = true
+		}
+	}
+	plan.exclude = make(map[string]bool, len(config.MapNamedExclude))
+	for _, name := range config.MapNamedExclude {
+		plan.exclude[name] = true
+	}
+	for _, mapping := range mappings {
+		if mapping.entityProperty != "" {
+			plan.mapped[mapping.entityProperty] = true
+		}
+	}
+	return plan, nil
+}
+
+// values returns the properties and then the references of entity under the base uri, each
+// ordered by uri, with their item property names. Entity properties of the property mappings are
+// left out if skipMapped is set.
+func (p *namedPlan) values(entity *egdm.Entity, skipMapped bool) ([]namedValue, error) {
+	values := make([]namedValue, 0, len(entity.Properties)+len(entity.References))
+	sources := make(map[string]string) // item property name -> entity property
+	for _, properties := range []map[string]any{entity.Properties, entity.References} {
+		uris := make([]string, 0, len(properties))
+		for uri := range properties {
+			if strings.HasPrefix(uri, p.baseURI) && len(uri) > len(p.baseURI) && !(skipMapped && p.mapped[uri]) {
+				uris = append(uris, uri)
+			}
+		}
+		sort.Strings(uris)
+		for _, uri := range uris {
+			name := uri[len(p.baseURI):]
+			if p.rename != nil {
+				name = p.rename(name)
+			}
+			if p.include != nil && !p.include[name] || p.exclude[name] {
+				continue
+			}
+			if other, ok := sources[name]; ok {
+				switch p.collision {
+				case CollisionFirst:
+					continue
+				case CollisionError:
+					return nil, fmt.Errorf("map_named: %s and %s both map to item property %s", other, uri, name)
+				case CollisionSuffix:
+					base := name
+					for i := 2; ok; i++ {
+						name = base + "_" + strconv.Itoa(i)
+						_, ok = sources[name]
+					}
+				}
+			}
+			sources[name] = uri
+			values = append(values, namedValue{name: name, value: properties[uri]})
+		}
+	}
+	return values, nil
+}
+
+// mapNamed sets the item properties of map_named
+func (mapper *Mapper) mapNamed(entity *egdm.Entity, item Item) error {
+	plan := mapper.incoming.named
+	schema := schemaOf(item)
+	var names []string
+	if len(schema) == 0 {
+		names = item.GetPropertyNames()
+	}
+	all := len(schema) == 0 && len(names) == 0
+	values, err := plan.values(entity, all)
+	if err != nil {
+		return fmt.Errorf("failed to map named properties of entity %s: %w", entity.ID, err)
+	}
+	if all {
+		for _, v := range values {
+			if err = setItemValue(item, v.name, v.value); err != nil {
+				return fmt.Errorf("failed to set property %s for entity %s: %w", v.name, entity.ID, err)
+			}
+		}
+		return nil
+	}
+
+	byName := make(map[string]any, len(values))
+	for _, v := range values {
+		byName[v.name] = v.value
+	}
+	// items with a schema get the properties of the schema, converted to their types
+	for _, field := range schema {
+		propertyValue, ok := byName[field.Name]
+		if !ok {
+			continue
+		}
+		convert, err := schemaConverter(field)
+		if err != nil {
+			return err
+		}
+		if convert != nil && propertyValue != nil {
+			if propertyValue, err = convertSchemaValue(convert, propertyValue); err != nil {
+				return fmt.Errorf("failed to convert property %s of entity %s to %s: %w", field.Name, entity.ID, field.Type, err)
+			}
+		}
+		if err = setItemValue(item, field.Name, propertyValue); err != nil {
+			return fmt.Errorf("failed to set property %s for entity %s: %w", field.Name, entity.ID, err)
+		}
+	}
+	for _, propertyName := range names {
+		if propertyValue, ok := byName[propertyName]; ok {
+			if err = setItemValue(item, propertyName, propertyValue); err != nil {
+				return fmt.Errorf("failed to set property %s for entity %s: %w", propertyName, entity.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// words splits a name into lower case words at separators and case changes, e.g. HTTPServer_id
+// into http, server and id
+func words(name string) []string {
+	runes := []rune(name)
+	result := make([]string, 0)
+	var word []rune
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == ' ' || r == '.' {
+			if len(word) > 0 {
+				result = append(result, string(word))
+				word = nil
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || unicode.IsUpper(previous) && nextIsLower {
+				result = append(result, string(word))
+				word = nil
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		result = append(result, string(word))
+	}
+	return result
+}
+
+// toSnakeCase converts a name to snake case, e.g. firstName to first_name
+func toSnakeCase(name string) string {
+	return strings.Join(words(name), "_")
+}
+
+// toCamelCase converts a name to lower camel case, e.g. first_name to firstName
+func toCamelCase(name string) string {
+	parts := words(name)
+	for i := 1; i < len(parts); i++ {
+		runes := []rune(parts[i])
+		runes[0] = unicode.ToUpper(runes[0])
+		parts[i] = string(runes)
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,100 @@
+package common_datalayer
+
+import (
+	"reflect"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestMapNamedWritesAllProperties(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/1")
+	entity.Properties["http://data.example.com/schema/firstName"] = "Homer"
+	entity.Properties["http://data.example.com/schema/lastName"] = "Simpson"
+	entity.Properties["http://data.example.com/schema/age"] = 39
+	entity.Properties["http://data.example.com/schema/secret"] = "donuts"
+	entity.Properties["http://xmlns.com/foaf/0.1/nick"] = "Homie"
+	entity.References["http://data.example.com/schema/worksFor"] = "http://data.example.com/companies/plant"
+	entity.References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] = "http://data.example.com/schema/Person"
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI:         "http://data.example.com/schema/",
+		MapNamed:        true,
+		MapNamedCase:    NameCaseSnake,
+		MapNamedExclude: []string{"secret"},
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "years", EntityProperty: "age"},
+		},
+	}
+	item := MapItem{}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+	expected := MapItem{
+		"id": "1", "first_name": "Homer", "last_name": "Simpson", "years": 39,
+		"works_for": "http://data.example.com/companies/plant",
+	}
+	if !reflect.DeepEqual(item, expected) {
+		t.Errorf("expected %v, got %v", expected, item)
+	}
+
+	// items with property names only get those
+	incomingConfig.MapNamedCase = NameCaseCamel
+	incomingConfig.MapNamedInclude = []string{"firstName", "age"}
+	item = MapItem{"firstName": nil, "lastName": nil, "age": nil}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+	if item["firstName"] != "Homer" || item["lastName"] != nil || item["age"] != 39 {
+		t.Errorf("unexpected item %v", item)
+	}
+}
+
+func TestMapNamedCollisions(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/1")
+	entity.Properties["http://data.example.com/schema/first_name"] = "Homer"
+	entity.Properties["http://data.example.com/schema/firstName"] = "Homer J."
+	entity.References["http://data.example.com/schema/first-name"] = "http://data.example.com/names/homer"
+
+	mapNamed := func(collision string) (MapItem, error) {
+		item := MapItem{}
+		config := &IncomingMappingConfig{BaseURI: "http://data.example.com/schema/", MapNamed: true, MapNamedCase: NameCaseSnake, MapNamedCollision: collision}
+		return item, NewMapper(logger, config, nil).MapEntityToItem(entity, item)
+	}
+	if item, err := mapNamed(""); err != nil || !reflect.DeepEqual(item, MapItem{"first_name": "Homer J."}) {
+		t.Errorf("expected first value, got %v, %v", item, err)
+	}
+	expected := MapItem{"first_name": "Homer J.", "first_name_2": "Homer", "first_name_3": "http://data.example.com/names/homer"}
+	if item, err := mapNamed(CollisionSuffix); err != nil || !reflect.DeepEqual(item, expected) {
+		t.Errorf("expected suffixed names, got %v, %v", item, err)
+	}
+	if _, err := mapNamed(CollisionError); err == nil {
+		t.Errorf("expected collision error")
+	}
+	if _, err := mapNamed("last"); err == nil {
+		t.Errorf("expected invalid collision to fail")
+	}
+}
+
+func TestNameCases(t *testing.T) {
+	tests := []struct{ name, snake, camel string }{
+		{"firstName", "first_name", "firstName"},
+		{"first_name", "first_name", "firstName"},
+		{"FirstName", "first_name", "firstName"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"address2Line", "address2_line", "address2Line"},
+		{"zip-code", "zip_code", "zipCode"},
+		{"ID", "id", "id"},
+	}
+	for _, test := range tests {
+		if snake := toSnakeCase(test.name); snake != test.snake {
+			t.Errorf("toSnakeCase(%s) = %s, expected %s", test.name, snake, test.snake)
+		}
+		if camel := toCamelCase(test.name); camel != test.camel {
+			t.Errorf("toCamelCase(%s) = %s, expected %s", test.name, camel, test.camel)
+		}
+	}
+}
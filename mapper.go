@@ -3,6 +3,7 @@ package common_datalayer
 import (
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -18,42 +19,76 @@ type Mapper struct {
 	outgoingMappingConfig       *OutgoingMappingConfig
 	itemToEntityCustomTransform []func(item Item, entity *egdm.Entity) error
 	entityToItemCustomTransform []func(entity *egdm.Entity, item Item) error
+	incoming                    *incomingPlan
+	outgoing                    *outgoingPlan
+	lookups                     *LookupTables
+	// compileErr is set if the mapping configs are invalid, mapping then fails with this error
+	compileErr error
 }
 
+// NewMapper compiles the mapping configs into plans, so that mapping an item or entity does not
+// validate the configs, resolve entity property names, compile uri patterns, regexes and
+// expressions or look up datatypes again. Invalid configs are reported by Err.
 func NewMapper(logger Logger, incomingMappingConfig *IncomingMappingConfig, outgoingMappingConfig *OutgoingMappingConfig) *Mapper {
+	return NewMapperWithLookups(logger, nil, incomingMappingConfig, outgoingMappingConfig)
+}
+
+// NewMapperWithLookups is NewMapper for mapping configs with lookup and reverse_lookup constructions.
+// The table names of the constructions must be tables of lookups, usually Config.LookupTables.
+func NewMapperWithLookups(logger Logger, lookups *LookupTables, incomingMappingConfig *IncomingMappingConfig, outgoingMappingConfig *OutgoingMappingConfig) *Mapper {
 	mapper := &Mapper{
 		logger:                      logger,
 		incomingMappingConfig:       incomingMappingConfig,
 		outgoingMappingConfig:       outgoingMappingConfig,
 		itemToEntityCustomTransform: make([]func(item Item, entity *egdm.Entity) error, 0),
 		entityToItemCustomTransform: make([]func(entity *egdm.Entity, item Item) error, 0),
+		lookups:                     lookups,
 	}
 
 	// ensure base URI ends with /
 	mapper.verifyBaseUri()
 
+	mapper.compileErr = mapper.compile()
+	if mapper.compileErr != nil {
+		logger.Error("Invalid mapping config", "error", mapper.compileErr.Error())
+	}
+
 	return mapper
 }
 
+// Err returns the error found in the mapping configs by NewMapper, or nil if they are valid.
+// MapItemToEntity and MapEntityToItem fail with this error, so data layers can check it up front.
+func (mapper *Mapper) Err() error {
+	return mapper.compileErr
+}
+
 func (mapper *Mapper) verifyBaseUri() {
 	if mapper.incomingMappingConfig != nil && mapper.incomingMappingConfig.BaseURI != "" {
-		if !strings.HasSuffix(mapper.incomingMappingConfig.BaseURI, "/") && !strings.HasSuffix(mapper.incomingMappingConfig.BaseURI, "#") {
+		if baseURI := normalizeBaseURI(mapper.incomingMappingConfig.BaseURI); baseURI != mapper.incomingMappingConfig.BaseURI {
 			mapper.logger.Debug("Adjusting incoming base URI", "base", mapper.incomingMappingConfig.BaseURI)
-			mapper.incomingMappingConfig.BaseURI = mapper.incomingMappingConfig.BaseURI + "/"
+			mapper.incomingMappingConfig.BaseURI = baseURI
 		}
 	} else if mapper.incomingMappingConfig != nil {
 		mapper.logger.Warn("No incoming base URI configured")
 	}
 	if mapper.outgoingMappingConfig != nil && mapper.outgoingMappingConfig.BaseURI != "" {
-		if !strings.HasSuffix(mapper.outgoingMappingConfig.BaseURI, "/") && !strings.HasSuffix(mapper.outgoingMappingConfig.BaseURI, "#") {
+		if baseURI := normalizeBaseURI(mapper.outgoingMappingConfig.BaseURI); baseURI != mapper.outgoingMappingConfig.BaseURI {
 			mapper.logger.Debug("Adjusting outgoing base URI", "base", mapper.outgoingMappingConfig.BaseURI)
-			mapper.outgoingMappingConfig.BaseURI = mapper.outgoingMappingConfig.BaseURI + "/"
+			mapper.outgoingMappingConfig.BaseURI = baseURI
 		}
 	} else if mapper.outgoingMappingConfig != nil {
 		mapper.logger.Warn("No outgoing base URI configured")
 	}
 }
 
+// normalizeBaseURI appends / to baseURI unless it is empty or ends with / or #
+func normalizeBaseURI(baseURI string) string {
+	if baseURI == "" || strings.HasSuffix(baseURI, "/") || strings.HasSuffix(baseURI, "#") {
+		return baseURI
+	}
+	return baseURI + "/"
+}
+
 func (mapper *Mapper) WithEntityToItemTransform(transform func(entity *egdm.Entity, item Item) error) *Mapper {
 	mapper.entityToItemCustomTransform = append(mapper.entityToItemCustomTransform, transform)
 	return mapper
@@ -83,8 +118,102 @@ func (m *mutableItem) NativeItem() any { return m.item.NativeItem() }
 
 func (m *mutableItem) GetPropertyNames() []string { return m.item.GetPropertyNames() }
 
+// entityItem exposes an entity as Item to incoming constructions. Properties and references are
+// looked up by full URI or by name relative to the base URI, properties first. The entity id,
+// deleted flag and recorded time are available as @id, @deleted and @recorded.
+type entityItem struct {
+	entity     *egdm.Entity
+	baseURI    string
+	namespaces map[string]string
+}
+
+func (e *entityItem) resolve(name string) string {
+	uri, _ := resolveURI(name, e.baseURI, e.namespaces)
+	return uri
+}
+
+func (e *entityItem) GetValue(name string) any {
+	switch name {
+	case "@id":
+		return e.entity.ID
+	case "@deleted":
+		return e.entity.IsDeleted
+	case "@recorded":
+		return e.entity.Recorded
+	}
+	uri := e.resolve(name)
+	if v, ok := e.entity.Properties[uri]; ok {
+		return v
+	}
+	if v, ok := e.entity.References[uri]; ok {
+		return v
+	}
+	return nil
+}
+
+// SetValue sets an entity property, it is not used by constructions
+func (e *entityItem) SetValue(name string, value any) { e.entity.Properties[e.resolve(name)] = value }
+
+func (e *entityItem) NativeItem() any { return e.entity }
+
+func (e *entityItem) GetPropertyNames() []string {
+	names := make([]string, 0, len(e.entity.Properties)+len(e.entity.References))
+	for uri := range e.entity.Properties {
+		names = append(names, strings.TrimPrefix(uri, e.baseURI))
+	}
+	for uri := range e.entity.References {
+		names = append(names, strings.TrimPrefix(uri, e.baseURI))
+	}
+	return names
+}
+
 func (mapper *Mapper) MapItemToEntity(item Item, entity *egdm.Entity) error {
-	mapper.logger.Debug("Mapping item to entity")
+	_, err := mapper.mapItemToEntity(item, entity)
+	return err
+}
+
+// MapItemToEntities maps item to its entity, followed by the entities it references through
+// mappings with an inverse_entity_property. These linked entities only have an id, the reference
+// uri, and the inverse references back to the entity of the item. Deleted entities and entities
+// without id have no linked entities. Filtered items return ErrItemFiltered like MapItemToEntity.
+// Linked entities are not merged across items: each replaces any other entity with the same id downstream.
+func (mapper *Mapper) MapItemToEntities(item Item) ([]*egdm.Entity, error) {
+	entity := egdm.NewEntity()
+	inverse, err := mapper.mapItemToEntity(item, entity)
+	if err != nil {
+		return nil, err
+	}
+	entities := []*egdm.Entity{entity}
+	if len(inverse) == 0 || entity.IsDeleted || entity.ID == "" {
+		return entities, nil
+	}
+	linked := make(map[string]*egdm.Entity)
+	for _, ref := range inverse {
+		for _, id := range ref.ids {
+			if id == entity.ID {
+				continue
+			}
+			target, ok := linked[id]
+			if !ok {
+				target = egdm.NewEntity().SetID(id)
+				linked[id] = target
+				entities = append(entities, target)
+			}
+			target.References[ref.property] = entity.ID
+		}
+	}
+	return entities, nil
+}
+
+// inverseReferences are the references of a mapping with an inverse_entity_property
+type inverseReferences struct {
+	property string
+	ids      []string
+}
+
+// mapItemToEntity maps item to entity and returns the references that need inverse references
+func (mapper *Mapper) mapItemToEntity(item Item, entity *egdm.Entity) ([]inverseReferences, error) {
+	var inverse []inverseReferences
 
 	// ensure props and refs are not nil
 	if entity.Properties == nil {
@@ -95,248 +224,188 @@ func (mapper *Mapper) MapItemToEntity(item Item, entity *egdm.Entity) error {
 		entity.References = make(map[string]any)
 	}
 
-	// apply constructions
-	constructedProperties := make(map[string]any)
-	item = &mutableItem{item, constructedProperties}
 	if mapper.outgoingMappingConfig == nil {
 		mapper.logger.Error("outgoing mapping config is nil")
-		return fmt.Errorf("outgoing mapping config is nil")
+		return nil, fmt.Errorf("outgoing mapping config is nil")
+	}
+	if mapper.compileErr != nil {
+		return nil, mapper.compileErr
 	}
+	plan := mapper.outgoing
 
-	if mapper.outgoingMappingConfig.Constructions != nil {
-		for _, construction := range mapper.outgoingMappingConfig.Constructions {
-			switch construction.Operation {
-			case "concat":
-				if len(construction.Arguments) != 2 {
-					return fmt.Errorf("concat operation requires two arguments")
-				}
-				concatedValue, err := concat(item, construction.Arguments[0], construction.Arguments[1])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = concatedValue
-			case "split":
-				if len(construction.Arguments) != 2 {
-					return fmt.Errorf("split operation requires two arguments")
-				}
-				splitValue, err := split(item, construction.Arguments[0], construction.Arguments[1])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = splitValue
-			case "replace":
-				if len(construction.Arguments) != 3 {
-					return fmt.Errorf("replace operation requires three arguments")
-				}
-				replacedValue, err := replace(item, construction.Arguments[0], construction.Arguments[1], construction.Arguments[2])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = replacedValue
-			case "trim":
-				if len(construction.Arguments) != 1 {
-					return fmt.Errorf("trim operation requires one argument")
-				}
-				trimmedValue, err := trim(item, construction.Arguments[0])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = trimmedValue
-			case "tolower":
-				if len(construction.Arguments) != 1 {
-					return fmt.Errorf("tolower operation requires one argument")
-				}
-				tolowerValue, err := tolower(item, construction.Arguments[0])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = tolowerValue
-			case "toupper":
-				if len(construction.Arguments) != 1 {
-					return fmt.Errorf("toupper operation requires one argument")
-				}
-				toupperValue, err := toupper(item, construction.Arguments[0])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = toupperValue
-			case "regex":
-				if len(construction.Arguments) != 2 {
-					return fmt.Errorf("regex operation requires two arguments")
-				}
-				regexValue, err := regex(item, construction.Arguments[0], construction.Arguments[1])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = regexValue
-			case "slice":
-				if len(construction.Arguments) != 3 {
-					return fmt.Errorf("slice operation requires three arguments")
-				}
-				slicedValue, err := slice(item, construction.Arguments[0], construction.Arguments[1], construction.Arguments[2])
-				if err != nil {
-					return err
-				}
-				constructedProperties[construction.PropertyName] = slicedValue
-			case "literal":
-				if len(construction.Arguments) != 1 {
-					return fmt.Errorf("literal operation requires one argument")
-				}
-				constructedProperties[construction.PropertyName] = construction.Arguments[0]
+	// apply constructions
+	var constructedProperties map[string]any
+	if len(plan.constructions) > 0 {
+		constructedProperties = make(map[string]any, len(plan.constructions))
+	}
+	source := item
+	item = &mutableItem{item, constructedProperties}
+	if err := applyConstructions(plan.constructions, item, constructedProperties); err != nil {
+		return nil, err
+	}
+
+	filteredAsDeleted := false
+	if plan.filter != nil {
+		keep, err := plan.filter.test(item)
+		if err != nil {
+			return nil, fmt.Errorf("outgoing filter failed. item: %+v, error: %w", item.NativeItem(), err)
+		}
+		if !keep {
+			if !plan.deleteFiltered {
+				return nil, ErrItemFiltered
 			}
+			filteredAsDeleted = true
 		}
 	}
 
 	if mapper.outgoingMappingConfig.MapAll {
-		// iterate over unmapped properties and add them to the entity
+		// iterate over unmapped properties and add them to the entity, encoder items list them in schema order
 		for _, propertyName := range item.GetPropertyNames() {
 			propertyValue := item.GetValue(propertyName)
+			if propertyValue == nil {
+				continue
+			}
 			entityPropertyName := mapper.outgoingMappingConfig.BaseURI + propertyName
 
 			value, err := mapper.mapSubEntities(propertyValue)
 			if err != nil {
-				return fmt.Errorf("failed to map sub entities. item: %+v, error: %w", item.NativeItem(), err)
+				return nil, fmt.Errorf("failed to map sub entities. item: %+v, error: %w", item.NativeItem(), err)
 			}
 			entity.Properties[entityPropertyName] = value
 		}
 	}
 
 	// apply mappings
-	for _, mapping := range mapper.outgoingMappingConfig.PropertyMappings {
-
-		if mapping.Property == "" {
-			return fmt.Errorf("property name is required, mapping: %+v", mapping)
+	for _, mapping := range plan.mappings {
+		if ok, err := applies(mapping.condition, item); err != nil {
+			return nil, fmt.Errorf("condition of mapping for property '%s' failed. item: %+v, error: %w", mapping.Property, item.NativeItem(), err)
+		} else if !ok {
+			continue
 		}
 
 		propertyName := mapping.Property
-		entityPropertyName := mapping.EntityProperty
-		if !strings.HasPrefix(entityPropertyName, "http") && entityPropertyName != "" {
-			if mapper.outgoingMappingConfig.BaseURI == "" {
-				return fmt.Errorf("base uri is required for mapping and entity_property isnt full URI. mapping: %+v", mapping)
-			}
-			entityPropertyName = mapper.outgoingMappingConfig.BaseURI + entityPropertyName
-		}
-
 		propertyValue, err := getValueFromItemOrConstruct(item, propertyName, constructedProperties)
 		if err != nil {
-			return fmt.Errorf("failed to get value from item or construct. item: %+v, error: %w", item.NativeItem(), err)
+			return nil, fmt.Errorf("failed to get value from item or construct. item: %+v, error: %w", item.NativeItem(), err)
 		}
-		if propertyValue == nil {
+		if propertyValue == nil && !mapping.composite {
 			if mapping.DefaultValue != nil {
 				propertyValue = mapping.DefaultValue
 			} else {
 				if mapping.Required || mapping.IsIdentity {
-					return fmt.Errorf("property %s is required. item: %+v", propertyName, item.NativeItem())
+					return nil, fmt.Errorf("property %s is required. item: %+v", propertyName, item.NativeItem())
 				}
 				continue
 			}
 		}
 
-		if mapping.Datatype != "" {
-			var err error
-			switch mapping.Datatype {
-			case "integer", "int":
-				propertyValue, err = int32OfValue(propertyValue)
-			case "long":
-				propertyValue, err = int64OfValue(propertyValue)
-			case "float":
-				propertyValue, err = float32OfValue(propertyValue)
-			case "double":
-				propertyValue, err = float64OfValue(propertyValue)
-			case "bool":
-				propertyValue, err = boolOfValue(propertyValue)
-			case "string":
-				propertyValue, err = stringOfValue(propertyValue)
-			default:
-				return fmt.Errorf("unsupported datatype %s", mapping.Datatype)
+		if mapping.sub != nil && propertyValue != nil {
+			value, err := mapping.sub.mapNestedToEntities(propertyValue, mapping.IsList)
+			if err != nil {
+				return nil, fmt.Errorf("failed to map nested property %s. item: %+v, error: %w", propertyName, item.NativeItem(), err)
+			}
+			if value != nil {
+				entity.Properties[mapping.entityProperty] = value
 			}
+			continue
+		}
 
+		values, isList := mapping.ListFormat.split(propertyValue)
+		if mapping.convert != nil && propertyValue != nil {
+			var err error
+			if isList {
+				err = convertValues(mapping.convert, values)
+			} else {
+				propertyValue, err = mapping.convert(propertyValue)
+			}
 			if err != nil {
-				return fmt.Errorf("failed to convert value to datatype. item: %+v, error: %w", item.NativeItem(), err)
+				return nil, fmt.Errorf("failed to convert value to datatype. item: %+v, error: %w", item.NativeItem(), err)
 			}
 		}
+		if isList && (mapping.convert != nil || mapping.ListFormat.enabled()) {
+			propertyValue = values
+		}
 
 		if mapping.IsIdentity {
-			idValue, err := stringOfValue(propertyValue)
-			if err != nil {
-				return fmt.Errorf("failed to convert identity value to string. item: %+v, error: %w", item.NativeItem(), err)
+			if isList {
+				return nil, fmt.Errorf("identity property %s must not be a list. item: %+v", propertyName, item.NativeItem())
 			}
-			if mapping.URIValuePattern == "" {
-				return fmt.Errorf("url value pattern is required for identity property. mapping: %+v", mapping)
+			entity.ID, err = mapping.pattern.expand(propertyValue, item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to make identity. item: %+v, error: %w", item.NativeItem(), err)
 			}
-			entity.ID = makeURL(mapping.URIValuePattern, idValue)
 		} else if mapping.IsReference {
-			if entityPropertyName == "" {
-				return fmt.Errorf("entity property name is required for mapping. mapping: %+v", mapping)
-			}
-
-			// reference property
 			var entityPropertyValue any
-
-			switch v := propertyValue.(type) {
-			case []string:
-				entityPropertyValue = make([]string, len(v))
-				for i, val := range v {
-					s, err := stringOfValue(val)
+			switch {
+			case isList:
+				refs := make([]string, len(values))
+				for i, val := range values {
+					refs[i], err = mapping.pattern.expand(val, item)
 					if err != nil {
-						return fmt.Errorf("failed to convert reference value to string value: %+v, item: %+v,error: %w", val, item.NativeItem(), err)
+						return nil, fmt.Errorf("failed to convert reference value to string value: %+v, item: %+v,error: %w", val, item.NativeItem(), err)
 					}
-					entityPropertyValue.([]string)[i] = makeURL(mapping.URIValuePattern, s)
 				}
+				entityPropertyValue = refs
 			default:
-				s, err := stringOfValue(propertyValue)
+				entityPropertyValue, err = mapping.pattern.expand(propertyValue, item)
 				if err != nil {
-					return fmt.Errorf("failed to convert reference value to string value: %+v, item: %+v,error: %w", propertyValue, item.NativeItem(), err)
+					return nil, fmt.Errorf("failed to convert reference value to string value: %+v, item: %+v,error: %w", propertyValue, item.NativeItem(), err)
 				}
-				entityPropertyValue = makeURL(mapping.URIValuePattern, s)
 			}
 
-			entity.References[entityPropertyName] = entityPropertyValue
+			entity.References[mapping.entityProperty] = entityPropertyValue
+			if mapping.inverse != "" {
+				ids, _ := entityPropertyValue.([]string)
+				if id, ok := entityPropertyValue.(string); ok {
+					ids = []string{id}
+				}
+				inverse = append(inverse, inverseReferences{property: mapping.inverse, ids: ids})
+			}
 		} else if mapping.IsDeleted {
 			if boolVal, ok := propertyValue.(bool); ok {
 				entity.IsDeleted = boolVal
 			} else {
-				return fmt.Errorf("IsDeleted property '%v' must be a bool. item: %+v", propertyName, item.NativeItem())
+				return nil, fmt.Errorf("IsDeleted property '%v' must be a bool. item: %+v", propertyName, item.NativeItem())
 			}
 		} else if mapping.IsRecorded {
 			intVal, err := int64OfValue(propertyValue)
 			if err != nil {
-				return fmt.Errorf("IsRecorded property '%v' must be a uint64 (unix timestamp), item: %+v, error: %w", propertyName, item.NativeItem(), err)
+				return nil, fmt.Errorf("IsRecorded property '%v' must be a uint64 (unix timestamp), item: %+v, error: %w", propertyName, item.NativeItem(), err)
 			}
 			entity.Recorded = uint64(intVal)
 		} else {
-			if entityPropertyName == "" {
-				return fmt.Errorf("entity property name is required for mapping: %+v", mapping)
-			}
-
 			// check if property is a sub item
 			value, err := mapper.mapSubEntities(propertyValue)
 			if err != nil {
-				return fmt.Errorf("failed to map sub entities. item: %+v, error: %w", item.NativeItem(), err)
+				return nil, fmt.Errorf("failed to map sub entities. item: %+v, error: %w", item.NativeItem(), err)
 			}
-			entity.Properties[entityPropertyName] = value
+			entity.Properties[mapping.entityProperty] = value
 		}
 	}
 
+	if plan.provenance != nil {
+		plan.provenance.apply(source, entity)
+	}
+
 	// apply custom transforms
-	if len(mapper.itemToEntityCustomTransform) > 0 {
-		mapper.logger.Debug("Applying custom transforms to entity")
-		for _, transform := range mapper.itemToEntityCustomTransform {
-			err := transform(item, entity)
-			if err != nil {
-				mapper.logger.Error("custom transform failed", "error", err.Error())
-				return fmt.Errorf("custom transform failed. mapper: %+v, item: %+v, error: %w", mapper, item.NativeItem(), err)
-			}
+	for _, transform := range mapper.itemToEntityCustomTransform {
+		err := transform(item, entity)
+		if err != nil {
+			mapper.logger.Error("custom transform failed", "error", err.Error())
+			return nil, fmt.Errorf("custom transform failed. mapper: %+v, item: %+v, error: %w", mapper, item.NativeItem(), err)
 		}
 	}
 
+	if filteredAsDeleted {
+		entity.IsDeleted = true
+	}
+
 	// apply default type if missing
-	if entity.References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] == nil && mapper.outgoingMappingConfig.DefaultType != "" {
-		entity.References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] = mapper.outgoingMappingConfig.DefaultType
+	if entity.References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] == nil && plan.defaultType != "" {
+		entity.References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] = plan.defaultType
 	}
 
-	mapper.logger.Debug("Finished mapping item to entity", "entityID", entity.ID)
-	return nil
+	return inverse, nil
 }
 
 // mapSubEntities takes a property value and maps it to a sub entity or array of sub entities if it is an Item or a slice of Items
@@ -362,59 +431,138 @@ func (mapper *Mapper) mapSubEntities(propertyValue any) (any, error) {
 			return propertyValue, fmt.Errorf("failed to map sub item to entity. item: %+v, error: %w", propertyValue.(Item).NativeItem(), err)
 		}
 		result = e
+	case []any:
+		// lists built by list mappings may contain items
+		values := make([]any, len(propertyValue.([]any)))
+		for i, v := range propertyValue.([]any) {
+			value, err := mapper.mapSubEntities(v)
+			if err != nil {
+				return propertyValue, err
+			}
+			values[i] = value
+		}
+		result = values
 	default:
 		result = propertyValue
 	}
 	return result, nil
 }
 
+// applyConstructions evaluates the constructions in order and stores the results in constructedProperties.
+// item must see the constructed properties, so that constructions can use the results of earlier constructions.
+func applyConstructions(constructions []*construction, item Item, constructedProperties map[string]any) error {
+	for _, c := range constructions {
+		value, err := c.eval(item)
+		if err != nil {
+			return fmt.Errorf("construction for property '%s' failed. item: %+v, error: %w", c.property, item.NativeItem(), err)
+		}
+		constructedProperties[c.property] = value
+	}
+	return nil
+}
+
+// uriValue returns the item value of an entity id or reference. With a uri pattern this is the
+// {value} placeholder, and the named placeholders are set on item unless item is nil. Without a
+// pattern the uri is returned, with the prefix removed if the mapping strips reference prefixes.
+func uriValue(mapping *incomingMapping, uri string, item Item) (string, error) {
+	pattern := mapping.pattern
+	if pattern == nil {
+		if mapping.StripReferencePrefix {
+			return stripURL(uri), nil
+		}
+		return uri, nil
+	}
+	values, err := pattern.parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if item != nil {
+		for _, name := range pattern.names {
+			if name == valuePlaceholder {
+				continue
+			}
+			if err := setItemValue(item, name, values[name]); err != nil {
+				return "", err
+			}
+		}
+	}
+	return values[valuePlaceholder], nil
+}
+
+// convertIncomingValue converts the value of an incoming mapping to the mapping datatype, lists are
+// converted element wise and joined if the mapping has a list separator
+func convertIncomingValue(mapping *incomingMapping, value any) (any, error) {
+	values, isList := mapping.ListFormat.elements(value)
+	if !isList {
+		if mapping.convert == nil {
+			return value, nil
+		}
+		return mapping.convert(value)
+	}
+	if mapping.convert != nil {
+		if err := convertValues(mapping.convert, values); err != nil {
+			return nil, err
+		}
+	}
+	if mapping.ListSeparator != "" {
+		return mapping.ListFormat.join(values)
+	}
+	if mapping.convert == nil && !mapping.IsList {
+		// keep lists untouched if there is nothing to do
+		return value, nil
+	}
+	return values, nil
+}
+
 func getValueFromItemOrConstruct(item Item, propertyName string, constructedProperties map[string]any) (any, error) {
 	if val, ok := constructedProperties[propertyName]; ok {
 		return val, nil
 	} else {
-		return item.GetValue(propertyName), nil
+		return getItemValue(item, propertyName)
 	}
 }
 
-func makeURL(urlPattern string, value string) string {
-	return strings.ReplaceAll(urlPattern, "{value}", value)
-}
-
-func regex(item Item, p1 string, pattern string) (string, error) {
+func regex(item Item, p1 string, re *regexp.Regexp) (string, error) {
 	s1, err := stringOfValue(item.GetValue(p1))
 	if err != nil {
 		return "", fmt.Errorf("regex: property '%s' could not be accessed. item: %+v, error: %w", p1, item.NativeItem(), err)
 	}
-	// Compile the regular expression pattern
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return "", fmt.Errorf("regex: invalid pattern: '%s'. item: %+v, error: %w", pattern, item.NativeItem(), err)
-	}
 
 	// Find the first match in the string
 	match := re.FindString(s1)
 	if match == "" {
-		return "", fmt.Errorf("regex: no match. pattern: '%s', property: '%s' item: %+v, error: %w", pattern, p1, item.NativeItem(), err)
+		return "", fmt.Errorf("regex: no match. pattern: '%s', property: '%s' item: %+v", re.String(), p1, item.NativeItem())
 	}
 
 	return match, nil
 }
 
-func slice(item Item, p1, p2, p3 string) (string, error) {
+func slice(item Item, p1 string, start, end int) (string, error) {
 	s1, err := stringOfValue(item.GetValue(p1))
 	if err != nil {
 		return "", fmt.Errorf("slice: property '%s' could not be accessed. item: %+v, error: %w", p1, item.NativeItem(), err)
 	}
+	// values shorter than the indexes give the part that is there, like substring in expressions
+	start = min(start, len(s1))
+	end = max(start, min(end, len(s1)))
+	return s1[start:end], nil
+}
 
-	start, err := int32OfValue(p2)
-	if err != nil {
-		return "", fmt.Errorf("slice: start index '%s' could not be parsed. item: %+v, error: %w", p2, item.NativeItem(), err)
-	}
-	end, err := int32OfValue(p3)
-	if err != nil {
-		return "", fmt.Errorf("slice: end index '%s' could not be parsed. item: %+v, error: %w", p3, item.NativeItem(), err)
+func strip(item Item, p1 string) (any, error) {
+	switch v := item.GetValue(p1).(type) {
+	case []string:
+		values := make([]string, len(v))
+		for i, val := range v {
+			values[i] = stripURL(val)
+		}
+		return values, nil
+	default:
+		s1, err := stringOfValue(v)
+		if err != nil {
+			return "", fmt.Errorf("strip: property '%s' could not be accessed. item: %+v, error: %w", p1, item.NativeItem(), err)
+		}
+		return stripURL(s1), nil
 	}
-	return s1[start:end], nil
 }
 
 func tolower(item Item, p1 string) (string, error) {
@@ -475,29 +623,29 @@ func concat(item Item, propName1, propName2 string) (string, error) {
 }
 
 func int32OfValue(val any) (int, error) {
-	if val == nil {
-		return 0, fmt.Errorf("value is nil")
-	}
-
-	v := reflect.ValueOf(val)
-	t := v.Type()
 	var value int64
-
-	switch t.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		value = v.Int()
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		value = int64(v.Uint())
-	case reflect.Float32, reflect.Float64:
-		value = int64(v.Float())
-	case reflect.String:
+	switch v := val.(type) {
+	case nil:
+		return 0, fmt.Errorf("value is nil")
+	case int:
+		value = int64(v)
+	case int64:
+		value = v
+	case float64:
 		var err error
-		value, err = strconv.ParseInt(v.String(), 10, strconv.IntSize)
-		if err != nil {
+		if value, err = int64OfFloat(v); err != nil {
+			return 0, err
+		}
+	case string:
+		var err error
+		if value, err = strconv.ParseInt(v, 10, 64); err != nil {
 			return 0, err
 		}
 	default:
-		return 0, fmt.Errorf("unsupported type %s", t.Kind())
+		var err error
+		if value, err = int64OfValue(val); err != nil {
+			return 0, err
+		}
 	}
 	if value < math.MinInt32 || value > math.MaxInt32 {
 		return 0, fmt.Errorf("value out of range for int type. Maybe try long(int64) instead")
@@ -506,8 +654,17 @@ func int32OfValue(val any) (int, error) {
 }
 
 func int64OfValue(val any) (int64, error) {
-	if val == nil {
+	switch v := val.(type) {
+	case nil:
 		return 0, fmt.Errorf("value is nil")
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64OfFloat(v)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
 	}
 
 	v := reflect.ValueOf(val)
@@ -517,26 +674,48 @@ func int64OfValue(val any) (int64, error) {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return v.Int(), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("value out of range for long type. Maybe try bigint instead")
+		}
 		return int64(v.Uint()), nil
 	case reflect.Float32, reflect.Float64:
-		return int64(v.Float()), nil
+		return int64OfFloat(v.Float())
 	case reflect.String:
-		value, err := strconv.ParseInt(v.String(), 10, strconv.IntSize)
-		if err != nil {
-			return 0, err
-		}
-		if value < math.MinInt || value > math.MaxInt {
-			return 0, fmt.Errorf("value out of range for int type")
-		}
-		return value, nil
+		return strconv.ParseInt(v.String(), 10, 64)
 	default:
+		if i, ok := val.(*big.Int); ok {
+			if !i.IsInt64() {
+				return 0, fmt.Errorf("value out of range for long type. Maybe try bigint instead")
+			}
+			return i.Int64(), nil
+		}
 		return 0, fmt.Errorf("unsupported type %s", t.Kind())
 	}
 }
 
+// int64OfFloat converts whole numbers, floats with a fraction are not truncated but rejected
+func int64OfFloat(f float64) (int64, error) {
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("value %v is not a whole number", f)
+	}
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("value out of range for long type. Maybe try bigint instead")
+	}
+	return int64(f), nil
+}
+
 func float64OfValue(val any) (float64, error) {
-	if val == nil {
+	switch v := val.(type) {
+	case nil:
 		return 0.0, fmt.Errorf("value is nil")
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
 	}
 
 	v := reflect.ValueOf(val)
@@ -552,6 +731,9 @@ func float64OfValue(val any) (float64, error) {
 	case reflect.String:
 		return strconv.ParseFloat(v.String(), 64)
 	default:
+		if s, ok := stringOfBigValue(val); ok {
+			return strconv.ParseFloat(s, 64)
+		}
 		return 0.0, fmt.Errorf("unsupported type %s", t.Kind())
 	}
 }
@@ -581,15 +763,20 @@ func float32OfValue(val any) (float32, error) {
 	default:
 		return 0.0, fmt.Errorf("unsupported type %s", t.Kind())
 	}
-	if value < math.SmallestNonzeroFloat32 || value > math.MaxFloat32 {
+	if math.Abs(value) > math.MaxFloat32 {
 		return 0, fmt.Errorf("value out of range for Float32 type. Maybe use double(float64) instead")
 	}
 	return float32(value), nil
 }
 
 func boolOfValue(val any) (bool, error) {
-	if val == nil {
+	switch v := val.(type) {
+	case nil:
 		return false, fmt.Errorf("value is nil")
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
 	}
 
 	v := reflect.ValueOf(val)
@@ -612,8 +799,19 @@ func boolOfValue(val any) (bool, error) {
 }
 
 func stringOfValue(val interface{}) (string, error) {
-	if val == nil {
+	switch v := val.(type) {
+	case nil:
 		return "", fmt.Errorf("value is nil")
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
 	}
 
 	v := reflect.ValueOf(val)
@@ -624,8 +822,10 @@ func stringOfValue(val interface{}) (string, error) {
 		return fmt.Sprintf("%d", v.Int()), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return fmt.Sprintf("%d", v.Uint()), nil
-	case reflect.Float32, reflect.Float64:
-		return fmt.Sprintf("%f", v.Float()), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
 	case reflect.String:
 		return v.String(), nil
 	case reflect.Bool:
@@ -636,6 +836,9 @@ func stringOfValue(val interface{}) (string, error) {
 		}
 		return "", fmt.Errorf("unsupported type %s (%s)", t.String(), t.Kind())
 	default:
+		if s, ok := stringOfBigValue(val); ok {
+			return s, nil
+		}
 		return "", fmt.Errorf("unsupported type %s", t.Kind())
 	}
 }
@@ -657,33 +860,60 @@ func stripURL(url string) string {
 }
 
 func (mapper *Mapper) MapEntityToItem(entity *egdm.Entity, item Item) error {
-	mapper.logger.Debug("Mapping entity to item", "entityID", entity.ID)
+	if mapper.incomingMappingConfig == nil {
+		mapper.logger.Error("incoming mapping config is nil")
+		return fmt.Errorf("incoming mapping config is nil")
+	}
+	if mapper.compileErr != nil {
+		return mapper.compileErr
+	}
+	plan := mapper.incoming
+
+	// apply constructions, the results are written to the item after the property mappings
+	var constructedProperties map[string]any
+	if len(plan.constructions) > 0 {
+		constructedProperties = make(map[string]any, len(plan.constructions))
+	}
+	source := &mutableItem{&entityItem{entity: entity, baseURI: mapper.incomingMappingConfig.BaseURI, namespaces: mapper.incomingMappingConfig.Namespaces}, constructedProperties}
+	if err := applyConstructions(plan.constructions, source, constructedProperties); err != nil {
+		return fmt.Errorf("failed to apply constructions for entity %s: %w", entity.ID, err)
+	}
+	if plan.filter != nil {
+		keep, err := plan.filter.test(source)
+		if err != nil {
+			return fmt.Errorf("incoming filter failed for entity %s: %w", entity.ID, err)
+		}
+		if !keep {
+			return ErrItemFiltered
+		}
+	}
 	// do map named as this is the more general case, then do the property mappings
 	if mapper.incomingMappingConfig.MapNamed {
-		for _, propertyName := range item.GetPropertyNames() {
-			entityPropertyName := mapper.incomingMappingConfig.BaseURI + propertyName
-			if propertyValue, ok := entity.Properties[entityPropertyName]; ok {
-				item.SetValue(propertyName, propertyValue)
-			}
+		if err := mapper.mapNamed(entity, item); err != nil {
+			return err
 		}
 	}
 
-	for _, mapping := range mapper.incomingMappingConfig.PropertyMappings {
-		propertyName := mapping.Property
-		entityPropertyName := mapping.EntityProperty
-		if !strings.HasPrefix(entityPropertyName, "http") && entityPropertyName != "" {
-			if mapper.incomingMappingConfig.BaseURI == "" {
-				return fmt.Errorf("base uri is required for mapping and entity_property isnt full URI. mapping: %+v", mapping)
-			}
-			entityPropertyName = mapper.incomingMappingConfig.BaseURI + entityPropertyName
+	for _, mapping := range plan.mappings {
+		if ok, err := applies(mapping.condition, source); err != nil {
+			return fmt.Errorf("condition of mapping for property '%s' failed for entity %s: %w", mapping.Property, entity.ID, err)
+		} else if !ok {
+			continue
 		}
+		propertyName := mapping.Property
+		entityPropertyName := mapping.entityProperty
 
+		var propertyValue any
 		if mapping.IsIdentity {
-			if mapping.StripReferencePrefix {
-				item.SetValue(propertyName, stripURL(entity.ID))
-			} else {
-				item.SetValue(propertyName, entity.ID)
+			id, err := uriValue(mapping, entity.ID, item)
+			if err != nil {
+				return fmt.Errorf("failed to map identity of entity %s: %w", entity.ID, err)
+			}
+			if propertyName == "" {
+				// composite identity, all values are set from the uri pattern
+				continue
 			}
+			propertyValue = id
 		} else if mapping.IsReference {
 			// reference property
 			if referenceValue, ok := entity.References[entityPropertyName]; ok {
@@ -691,64 +921,112 @@ func (mapper *Mapper) MapEntityToItem(entity *egdm.Entity, item Item) error {
 				case []string:
 					values := make([]string, len(v))
 					for i, val := range v {
-						if mapping.StripReferencePrefix {
-							values[i] = stripURL(val)
-						} else {
-							values[i] = val
+						value, err := uriValue(mapping, val, nil)
+						if err != nil {
+							return fmt.Errorf("failed to map reference property '%s' of entity %s: %w", propertyName, entity.ID, err)
 						}
+						values[i] = value
 					}
-					item.SetValue(propertyName, values)
+					propertyValue = values
 				case string:
-					if mapping.StripReferencePrefix {
-						item.SetValue(propertyName, stripURL(v))
-					} else {
-						item.SetValue(propertyName, v)
+					value, err := uriValue(mapping, v, item)
+					if err != nil {
+						return fmt.Errorf("failed to map reference property '%s' of entity %s: %w", propertyName, entity.ID, err)
 					}
+					propertyValue = value
 				default:
 					mapper.logger.Error("unsupported reference type", "type", reflect.TypeOf(referenceValue), "entity", entity.ID)
 					return fmt.Errorf("unsupported reference type %s, value %v, entityId: %s", reflect.TypeOf(referenceValue), referenceValue, entity.ID)
 				}
 			} else if mapping.DefaultValue != "" {
 				// if the reference is not set, use the default value
-				if mapping.StripReferencePrefix {
-					item.SetValue(propertyName, stripURL(mapping.DefaultValue))
-				} else {
-					item.SetValue(propertyName, mapping.DefaultValue)
+				var err error
+				if propertyValue, err = uriValue(mapping, mapping.DefaultValue, item); err != nil {
+					return fmt.Errorf("invalid default value for reference property '%s' of entity %s: %w", propertyName, entity.ID, err)
 				}
 			} else if mapping.Required {
 				mapper.logger.Error("required reference property missing", "property", propertyName, "entity", entity.ID)
 				return fmt.Errorf("required reference property '%s' is not set for entity %s", propertyName, entity.ID)
 			} else {
 				// do nothing, reference is not set and not required
+				continue
 			}
 		} else if mapping.IsDeleted {
-			item.SetValue(propertyName, entity.IsDeleted)
+			if err := setItemValue(item, propertyName, entity.IsDeleted); err != nil {
+				return fmt.Errorf("failed to set property %s for entity %s: %w", propertyName, entity.ID, err)
+			}
+			continue
 		} else if mapping.IsRecorded {
-			item.SetValue(propertyName, entity.Recorded)
+			if err := setItemValue(item, propertyName, entity.Recorded); err != nil {
+				return fmt.Errorf("failed to set property %s for entity %s: %w", propertyName, entity.ID, err)
+			}
+			continue
 		} else {
 			// regular property
-			if propertyValue, ok := entity.Properties[entityPropertyName]; ok {
-				item.SetValue(propertyName, propertyValue)
+			if value, ok := entity.Properties[entityPropertyName]; ok && value != nil {
+				propertyValue = value
 			} else if mapping.DefaultValue != "" {
-				item.SetValue(propertyName, mapping.DefaultValue)
+				propertyValue = mapping.DefaultValue
+			} else if mapping.Required {
+				mapper.logger.Error("required property missing", "property", propertyName, "entity", entity.ID)
+				return fmt.Errorf("required property '%s' (entity property '%s') is not set for entity %s", propertyName, entityPropertyName, entity.ID)
+			} else if ok {
+				// keep explicit null values
+				propertyValue = nil
+			} else {
+				continue
 			}
 		}
 
+		if propertyName == "" {
+			// composite references only set the values of the uri pattern
+			continue
+		}
+		if mapping.sub != nil && propertyValue != nil {
+			nested, err := mapping.sub.mapNestedToItems(propertyValue, mapping.IsList)
+			if err != nil {
+				return fmt.Errorf("failed to map sub-entities of property '%s' (entity property '%s') of entity %s: %w", propertyName, entityPropertyName, entity.ID, err)
+			}
+			if nested == nil {
+				continue
+			}
+			if err := setItemValue(item, propertyName, nested); err != nil {
+				return fmt.Errorf("failed to set property %s for entity %s: %w", propertyName, entity.ID, err)
+			}
+			continue
+		}
+		if (mapping.convert != nil || mapping.ListFormat.enabled()) && propertyValue != nil {
+			converted, err := convertIncomingValue(mapping, propertyValue)
+			if err != nil {
+				return fmt.Errorf("failed to convert property '%s' (entity property '%s') of entity %s to %s: %w", propertyName, entityPropertyName, entity.ID, mapping.Datatype, err)
+			}
+			propertyValue = converted
+		}
+		if err := setItemValue(item, propertyName, propertyValue); err != nil {
+			return fmt.Errorf("failed to set property %s for entity %s: %w", propertyName, entity.ID, err)
+		}
+	}
+
+	// constructed properties override mapped properties with the same name, null results and internal
+	// constructions are not written
+	for _, c := range plan.constructions {
+		if c.internal || constructedProperties[c.property] == nil {
+			continue
+		}
+		if err := setItemValue(item, c.property, constructedProperties[c.property]); err != nil {
+			return fmt.Errorf("failed to set constructed property %s for entity %s: %w", c.property, entity.ID, err)
+		}
 	}
 
 	// apply custom transforms
-	if len(mapper.entityToItemCustomTransform) > 0 {
-		mapper.logger.Debug("Applying custom transforms to item")
-		for _, transform := range mapper.entityToItemCustomTransform {
-			err := transform(entity, item)
-			if err != nil {
-				mapper.logger.Error("custom transform failed", "error", err.Error())
-				return fmt.Errorf("custom transform failed. mapper: %+v, entity: %+v, error: %w", mapper, entity, err)
-			}
+	for _, transform := range mapper.entityToItemCustomTransform {
+		err := transform(entity, item)
+		if err != nil {
+			mapper.logger.Error("custom transform failed", "error", err.Error())
+			return fmt.Errorf("custom transform failed. mapper: %+v, entity: %+v, error: %w", mapper, entity, err)
 		}
 	}
 
-	mapper.logger.Debug("Finished mapping entity to item", "entityID", entity.ID)
 	return nil
 }
 
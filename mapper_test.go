@@ -1,8 +1,10 @@
 package common_datalayer
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -311,6 +313,36 @@ func TestMapOutgoingItemWithPropertyMappingOfDifferentTypes(t *testing.T) {
 	}
 }
 
+func TestSliceConstruction(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	mapperFor := func(start, end string) *Mapper {
+		return NewMapper(logger, nil, &OutgoingMappingConfig{
+			BaseURI: "http://data.example.com/schema/",
+			Constructions: []*PropertyConstructor{
+				{PropertyName: "code", Operation: "slice", Arguments: []string{"code", start, end}},
+			},
+			PropertyMappings: []*ItemToEntityPropertyMapping{{Property: "code", EntityProperty: "code"}},
+		})
+	}
+
+	mapper := mapperFor("2", "5")
+	for value, expected := range map[string]string{"NO12345": "123", "NO12": "12", "N": "", "": ""} {
+		entity := egdm.NewEntity()
+		if err := mapper.MapItemToEntity(MapItem{"code": value}, entity); err != nil {
+			t.Fatal(err)
+		}
+		if code := entity.Properties["http://data.example.com/schema/code"]; code != expected {
+			t.Errorf("slice of '%s': expected '%s', got '%v'", value, expected, code)
+		}
+	}
+
+	for _, indexes := range [][]string{{"-1", "2"}, {"3", "2"}, {"0", "-2"}} {
+		if mapperFor(indexes[0], indexes[1]).Err() == nil {
+			t.Errorf("expected slice %v to be rejected", indexes)
+		}
+	}
+}
+
 func TestMapOutgoingWithChainedConstructions(t *testing.T) {
 	logger := NewLogger("testService", "text", "info")
 
@@ -1527,3 +1559,708 @@ func TestMapOutgoingItemWithPropertyDatatypeCastingInvalidValue(t *testing.T) {
 		t.Error("wrong error message")
 	}
 }
+
+func TestMapOutgoingItemWithPropertyPaths(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "$.person.id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "$.names[0].firstname", EntityProperty: "name"},
+			{Property: "$.names[*].firstname", EntityProperty: "allNames"},
+		},
+	}
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("person", map[string]any{"id": "1"})
+	item.SetValue("names", []any{map[string]any{"firstname": "homer"}, map[string]any{"firstname": "max"}})
+
+	mapper := NewMapper(logger, nil, outgoingConfig)
+
+	entity := egdm.NewEntity()
+	err := mapper.MapItemToEntity(item, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entity.ID != "http://data.example.com/1" {
+		t.Errorf("entity ID should be http://data.example.com/1, got %s", entity.ID)
+	}
+	if entity.Properties["http://data.example.com/schema/name"] != "homer" {
+		t.Error("entity property name should be homer")
+	}
+	names, ok := entity.Properties["http://data.example.com/schema/allNames"].([]any)
+	if !ok || len(names) != 2 || names[1] != "max" {
+		t.Errorf("entity property allNames should be list of all names, got %v", entity.Properties["http://data.example.com/schema/allNames"])
+	}
+}
+
+func TestMapIncomingEntityWithPropertyPaths(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "$.person.id", IsIdentity: true, StripReferencePrefix: true},
+			{Property: "$.names[0].firstname", EntityProperty: "name"},
+		},
+	}
+
+	entity := egdm.NewEntity().SetID("http://data.example.com/1")
+	entity.SetProperty("http://data.example.com/schema/name", "homer")
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	mapper := NewMapper(logger, incomingConfig, nil)
+	err := mapper.MapEntityToItem(entity, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.GetValue("person").(map[string]any)["id"] != "1" {
+		t.Errorf("nested id should be set, got %v", item.properties)
+	}
+	names := item.GetValue("names").([]any)
+	if names[0].(map[string]any)["firstname"] != "homer" {
+		t.Errorf("nested name should be set, got %v", item.properties)
+	}
+}
+
+func TestMapOutgoingWithExpressionConstructions(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Constructions: []*PropertyConstructor{
+			{PropertyName: "key", Expression: "lower(trim(first)) + '-' + id"},
+			{PropertyName: "label", Expression: "upper(key)"},
+		},
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "key", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "label", EntityProperty: "label"},
+		},
+	}
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("first", " Homer ")
+	item.SetValue("id", 1)
+
+	mapper := NewMapper(logger, nil, outgoingConfig)
+	entity := egdm.NewEntity()
+	err := mapper.MapItemToEntity(item, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entity.ID != "http://data.example.com/homer-1" {
+		t.Errorf("entity ID should be http://data.example.com/homer-1, got %s", entity.ID)
+	}
+	if entity.Properties["http://data.example.com/schema/label"] != "HOMER-1" {
+		t.Errorf("chained expression should see constructed property, got %v", entity.Properties)
+	}
+}
+
+func TestMapOutgoingWithInvalidExpression(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Constructions: []*PropertyConstructor{
+			{PropertyName: "key", Expression: "lower(first"},
+		},
+	}
+
+	mapper := NewMapper(logger, nil, outgoingConfig)
+	err := mapper.MapItemToEntity(&InMemoryItem{properties: make(map[string]interface{})}, egdm.NewEntity())
+	if err == nil {
+		t.Fatal("mapping with invalid expression should fail")
+	}
+	if !strings.Contains(err.Error(), "construction 0 for property 'key'") {
+		t.Errorf("error should reference the construction, got %s", err.Error())
+	}
+}
+
+func TestMapIncomingEntityWithConstructions(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		Constructions: []*PropertyConstructor{
+			{PropertyName: "id", Operation: "strip", Arguments: []string{"@id"}},
+			{PropertyName: "companyId", Operation: "strip", Arguments: []string{"worksFor"}},
+			{PropertyName: "fullName", Operation: "concat", Arguments: []string{"firstName", "http://data.example.com/schema/lastName"}, Internal: true},
+			{PropertyName: "key", Expression: "lower(fullName) + '@' + companyId"},
+		},
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "firstName", EntityProperty: "firstName"},
+		},
+	}
+
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/1")
+	entity.SetProperty("http://data.example.com/schema/firstName", "Homer")
+	entity.SetProperty("http://data.example.com/schema/lastName", "Simpson")
+	entity.SetReference("http://data.example.com/schema/worksFor", "http://data.example.com/companies/plant")
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	mapper := NewMapper(logger, incomingConfig, nil)
+	err := mapper.MapEntityToItem(entity, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"id":        "1",
+		"companyId": "plant",
+		"firstName": "Homer",
+		"key":       "homersimpson@plant",
+	}
+	for name, value := range expected {
+		if item.GetValue(name) != value {
+			t.Errorf("item property %s should be %v, got %v", name, value, item.GetValue(name))
+		}
+	}
+	// internal constructions only feed other constructions
+	if _, ok := item.properties["fullName"]; ok {
+		t.Errorf("internal construction fullName should not be written to the item")
+	}
+}
+
+func TestMapDateTimeDatatypes(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "dateofbirth", EntityProperty: "dob", Datatype: "DateTime", TimeFormat: TimeFormat{InputLayout: "02.01.2006"}},
+			{Property: "modified", EntityProperty: "modified", Datatype: "date"},
+		},
+	}
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "1")
+	item.SetValue("dateofbirth", "12.05.1956")
+	item.SetValue("modified", int64(1700000000))
+
+	entity := egdm.NewEntity()
+	if err := NewMapper(logger, nil, outgoingConfig).MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.Properties["http://data.example.com/schema/dob"] != time.Date(1956, 5, 12, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("dob should be parsed to time, got %v", entity.Properties["http://data.example.com/schema/dob"])
+	}
+	if entity.Properties["http://data.example.com/schema/modified"] != "2023-11-14" {
+		t.Errorf("modified should be formatted as date, got %v", entity.Properties["http://data.example.com/schema/modified"])
+	}
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "dateofbirth", EntityProperty: "dob", Datatype: "date", TimeFormat: TimeFormat{OutputLayout: "02.01.2006"}},
+			{Property: "modified", EntityProperty: "modified", Datatype: "unix_ms"},
+		},
+	}
+	item = &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+	if item.GetValue("dateofbirth") != "12.05.1956" {
+		t.Errorf("dateofbirth should be formatted with output layout, got %v", item.GetValue("dateofbirth"))
+	}
+	if item.GetValue("modified") != int64(1699920000000) {
+		t.Errorf("modified should be converted to unix milliseconds, got %v", item.GetValue("modified"))
+	}
+}
+
+func TestMapOutgoingItemWithLosslessDatatypes(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, Datatype: "uuid", URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "amount", EntityProperty: "amount", Datatype: "decimal(18,2)"},
+			{Property: "counter", EntityProperty: "counter", Datatype: "bigint"},
+		},
+	}
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "F47AC10B58CC4372A5670E02B2C3D479")
+	item.SetValue("amount", json.Number("1234567890123456.785"))
+	item.SetValue("counter", "18446744073709551616")
+
+	entity := egdm.NewEntity()
+	if err := NewMapper(logger, nil, outgoingConfig).MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID != "http://data.example.com/f47ac10b-58cc-4372-a567-0e02b2c3d479" {
+		t.Errorf("identity should use canonical uuid, got %s", entity.ID)
+	}
+	data, err := json.Marshal(entity.Properties)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"http://data.example.com/schema/amount":1234567890123456.79,"http://data.example.com/schema/counter":18446744073709551616}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, string(data))
+	}
+}
+
+func TestMapIncomingEntityWithDatatypesAndRequired(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, StripReferencePrefix: true, Datatype: "long"},
+			{Property: "age", EntityProperty: "age", Datatype: "int"},
+			{Property: "score", EntityProperty: "score", Datatype: "decimal(5,2)"},
+			{Property: "active", EntityProperty: "active", Datatype: "bool", DefaultValue: "true"},
+			{Property: "born", EntityProperty: "born", Datatype: "date"},
+			{Property: "name", EntityProperty: "name", Required: true},
+		},
+	}
+
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/42")
+	entity.SetProperty("http://data.example.com/schema/age", float64(39))
+	entity.SetProperty("http://data.example.com/schema/score", 12.5)
+	entity.SetProperty("http://data.example.com/schema/born", "1956-05-12T10:00:00Z")
+	entity.SetProperty("http://data.example.com/schema/name", "Homer")
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	mapper := NewMapper(logger, incomingConfig, nil)
+	if err := mapper.MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"id":     int64(42),
+		"age":    39,
+		"score":  json.Number("12.50"),
+		"active": true,
+		"born":   "1956-05-12",
+		"name":   "Homer",
+	}
+	for name, value := range expected {
+		if item.GetValue(name) != value {
+			t.Errorf("item property %s should be %v (%T), got %v (%T)", name, value, value, item.GetValue(name), item.GetValue(name))
+		}
+	}
+
+	// missing required property
+	delete(entity.Properties, "http://data.example.com/schema/name")
+	err := mapper.MapEntityToItem(entity, &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)})
+	if err == nil || !strings.Contains(err.Error(), "required property 'name'") || !strings.Contains(err.Error(), entity.ID) {
+		t.Errorf("expected required property error, got %v", err)
+	}
+
+	// conversion failure
+	entity.SetProperty("http://data.example.com/schema/name", "Homer")
+	entity.SetProperty("http://data.example.com/schema/age", "old")
+	err = mapper.MapEntityToItem(entity, &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)})
+	if err == nil || !strings.Contains(err.Error(), "property 'age'") || !strings.Contains(err.Error(), entity.ID) {
+		t.Errorf("expected conversion error, got %v", err)
+	}
+}
+
+func TestMapOutgoingListMappings(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/{value}"},
+			{Property: "scores", EntityProperty: "scores", Datatype: "long"},
+			{Property: "tags", EntityProperty: "tags", ListFormat: ListFormat{ListSeparator: ";"}},
+			{Property: "friends", EntityProperty: "friends", IsReference: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "owner", EntityProperty: "owner", IsReference: true, URIValuePattern: "http://data.example.com/people/{value}", ListFormat: ListFormat{IsList: true}},
+			{Property: "dates", EntityProperty: "dates", Datatype: "date", ListFormat: ListFormat{ListSeparator: ","}},
+		},
+	}
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "1")
+	item.SetValue("scores", []any{"1", 2.0, int32(3)})
+	item.SetValue("tags", "a; b;;c")
+	item.SetValue("friends", []any{1, "2"})
+	item.SetValue("owner", "3")
+	item.SetValue("dates", "2024-01-02T10:00:00Z, 2024-02-03")
+
+	entity := egdm.NewEntity()
+	if err := NewMapper(logger, nil, outgoingConfig).MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedProperties := map[string]any{
+		"scores": []any{int64(1), int64(2), int64(3)},
+		"tags":   []any{"a", "b", "c"},
+		"dates":  []any{"2024-01-02", "2024-02-03"},
+	}
+	for name, value := range expectedProperties {
+		if !reflect.DeepEqual(entity.Properties["http://data.example.com/schema/"+name], value) {
+			t.Errorf("property %s should be %v, got %v", name, value, entity.Properties["http://data.example.com/schema/"+name])
+		}
+	}
+	expectedReferences := map[string]any{
+		"friends": []string{"http://data.example.com/people/1", "http://data.example.com/people/2"},
+		"owner":   []string{"http://data.example.com/people/3"},
+	}
+	for name, value := range expectedReferences {
+		if !reflect.DeepEqual(entity.References["http://data.example.com/schema/"+name], value) {
+			t.Errorf("reference %s should be %v, got %v", name, value, entity.References["http://data.example.com/schema/"+name])
+		}
+	}
+	// the item list must not be modified by the conversion
+	if item.GetValue("scores").([]any)[0] != "1" {
+		t.Errorf("item list was modified")
+	}
+}
+
+func TestMapIncomingListMappings(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "scores", EntityProperty: "scores", Datatype: "long"},
+			{Property: "tags", EntityProperty: "tags", ListFormat: ListFormat{ListSeparator: ";"}},
+			{Property: "friends", EntityProperty: "friends", IsReference: true, StripReferencePrefix: true, Datatype: "int", ListFormat: ListFormat{ListSeparator: ","}},
+			{Property: "name", EntityProperty: "name", ListFormat: ListFormat{IsList: true}},
+		},
+	}
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/1")
+	entity.SetProperty("http://data.example.com/schema/scores", []any{1.0, "2"})
+	entity.SetProperty("http://data.example.com/schema/tags", []any{"a", "b"})
+	entity.SetProperty("http://data.example.com/schema/name", "Homer")
+	entity.SetReference("http://data.example.com/schema/friends", []string{"http://data.example.com/people/2", "http://data.example.com/people/3"})
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"scores":  []any{int64(1), int64(2)},
+		"tags":    "a;b",
+		"friends": "2,3",
+		"name":    []any{"Homer"},
+	}
+	for name, value := range expected {
+		if !reflect.DeepEqual(item.GetValue(name), value) {
+			t.Errorf("item property %s should be %v, got %v", name, value, item.GetValue(name))
+		}
+	}
+}
+
+func TestMapCompositeIdentity(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{IsIdentity: true, URIValuePattern: "http://data.example.com/orgs/{orgId}/users/{userId}"},
+			{Property: "manager", EntityProperty: "manager", IsReference: true, URIValuePattern: "http://data.example.com/orgs/{orgId}/users/{value}"},
+		},
+	}
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{IsIdentity: true, URIValuePattern: "http://data.example.com/orgs/{orgId}/users/{userId}"},
+			{Property: "manager", EntityProperty: "manager", IsReference: true, Datatype: "long", URIValuePattern: "http://data.example.com/orgs/{managerOrgId}/users/{value}"},
+		},
+	}
+	mapper := NewMapper(logger, incomingConfig, outgoingConfig)
+
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("orgId", "acme inc")
+	item.SetValue("userId", "7")
+	item.SetValue("manager", 3)
+
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID != "http://data.example.com/orgs/acme%20inc/users/7" {
+		t.Errorf("unexpected id %s", entity.ID)
+	}
+	if entity.References["http://data.example.com/schema/manager"] != "http://data.example.com/orgs/acme%20inc/users/3" {
+		t.Errorf("unexpected manager %v", entity.References["http://data.example.com/schema/manager"])
+	}
+
+	result := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := mapper.MapEntityToItem(entity, result); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"orgId": "acme inc", "userId": "7", "manager": int64(3), "managerOrgId": "acme inc"}
+	if !reflect.DeepEqual(result.properties, expected) {
+		t.Errorf("expected %v, got %v", expected, result.properties)
+	}
+
+	entity.ID = "http://data.example.com/people/7"
+	err := mapper.MapEntityToItem(entity, &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)})
+	if err == nil || !strings.Contains(err.Error(), "does not match uri pattern") {
+		t.Errorf("expected pattern mismatch error, got %v", err)
+	}
+}
+
+func TestNewMapperReportsInvalidConfig(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	tests := map[string]*OutgoingMappingConfig{
+		"unsupported datatype": {BaseURI: "http://data.example.com/", PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "age", EntityProperty: "age", Datatype: "number"},
+		}},
+		"invalid time zone": {BaseURI: "http://data.example.com/", PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "born", EntityProperty: "born", Datatype: "date", TimeFormat: TimeFormat{TimeZone: "Mars/Olympus"}},
+		}},
+		"invalid regex": {BaseURI: "http://data.example.com/", Constructions: []*PropertyConstructor{
+			{PropertyName: "code", Operation: "regex", Arguments: []string{"name", "[a-z"}},
+		}},
+		"missing argument": {BaseURI: "http://data.example.com/", Constructions: []*PropertyConstructor{
+			{PropertyName: "code", Operation: "concat", Arguments: []string{"name"}},
+		}},
+		"unsupported operation": {BaseURI: "http://data.example.com/", Constructions: []*PropertyConstructor{
+			{PropertyName: "code", Operation: "reverse", Arguments: []string{"name"}},
+		}},
+		"relative entity property": {PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "name", EntityProperty: "name"},
+		}},
+	}
+	for name, config := range tests {
+		mapper := NewMapper(logger, nil, config)
+		if mapper.Err() == nil {
+			t.Errorf("%s: expected invalid config", name)
+			continue
+		}
+		if err := mapper.MapItemToEntity(&InMemoryItem{properties: map[string]any{}}, egdm.NewEntity()); err != mapper.Err() {
+			t.Errorf("%s: expected mapping to fail with %v, got %v", name, mapper.Err(), err)
+		}
+	}
+
+	valid := NewMapper(logger, &IncomingMappingConfig{BaseURI: "http://data.example.com/"}, &OutgoingMappingConfig{BaseURI: "http://data.example.com/"})
+	if valid.Err() != nil {
+		t.Errorf("unexpected error %v", valid.Err())
+	}
+}
+
+func benchmarkMappingConfigs() (*IncomingMappingConfig, *OutgoingMappingConfig) {
+	incoming := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "name", EntityProperty: "name", Datatype: "string"},
+			{Property: "age", EntityProperty: "age", Datatype: "int"},
+			{Property: "salary", EntityProperty: "salary", Datatype: "double"},
+			{Property: "active", EntityProperty: "active", Datatype: "bool"},
+			{Property: "born", EntityProperty: "born", Datatype: "date"},
+			{Property: "tags", EntityProperty: "tags", ListFormat: ListFormat{ListSeparator: ";"}},
+			{Property: "company", EntityProperty: "worksFor", IsReference: true, URIValuePattern: "http://data.example.com/companies/{value}"},
+		},
+	}
+	outgoing := &OutgoingMappingConfig{
+		BaseURI:     "http://data.example.com/schema/",
+		DefaultType: "http://data.example.com/schema/Person",
+		Constructions: []*PropertyConstructor{
+			{PropertyName: "code", Operation: "regex", Arguments: []string{"name", "[A-Z][a-z]+"}},
+		},
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "name", EntityProperty: "name", Datatype: "string"},
+			{Property: "code", EntityProperty: "code"},
+			{Property: "age", EntityProperty: "age", Datatype: "int"},
+			{Property: "salary", EntityProperty: "salary", Datatype: "double"},
+			{Property: "active", EntityProperty: "active", Datatype: "bool"},
+			{Property: "born", EntityProperty: "born", Datatype: "date"},
+			{Property: "tags", EntityProperty: "tags", Datatype: "string", ListFormat: ListFormat{ListSeparator: ";"}},
+			{Property: "company", EntityProperty: "worksFor", IsReference: true, URIValuePattern: "http://data.example.com/companies/{value}"},
+			{Property: "active", EntityProperty: "adultMember", Datatype: "bool", Condition: "age >= 18"},
+		},
+	}
+	return incoming, outgoing
+}
+
+func BenchmarkMapItemToEntity(b *testing.B) {
+	_, outgoing := benchmarkMappingConfigs()
+	mapper := NewMapper(NewLogger("testService", "text", "info"), nil, outgoing)
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "42")
+	item.SetValue("name", "Homer Simpson")
+	item.SetValue("age", 39)
+	item.SetValue("salary", 51234.5)
+	item.SetValue("active", "true")
+	item.SetValue("born", "1956-05-12")
+	item.SetValue("tags", "father;safety inspector")
+	item.SetValue("company", "springfield-nuclear")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := mapper.MapItemToEntity(item, egdm.NewEntity()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMapEntityToItem(b *testing.B) {
+	incoming, _ := benchmarkMappingConfigs()
+	mapper := NewMapper(NewLogger("testService", "text", "info"), incoming, nil)
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/42")
+	entity.SetProperty("http://data.example.com/schema/name", "Homer Simpson")
+	entity.SetProperty("http://data.example.com/schema/age", 39.0)
+	entity.SetProperty("http://data.example.com/schema/salary", 51234.5)
+	entity.SetProperty("http://data.example.com/schema/active", true)
+	entity.SetProperty("http://data.example.com/schema/born", "1956-05-12")
+	entity.SetProperty("http://data.example.com/schema/tags", []any{"father", "safety inspector"})
+	entity.SetReference("http://data.example.com/schema/worksFor", "http://data.example.com/companies/springfield-nuclear")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		item := &InMemoryItem{properties: make(map[string]interface{}, 8), propertyNames: make([]string, 0, 8)}
+		if err := mapper.MapEntityToItem(entity, item); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMapNestedObjectsWithSubMappings(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "address", EntityProperty: "address", SubMapping: &OutgoingMappingConfig{
+				PropertyMappings: []*ItemToEntityPropertyMapping{
+					{Property: "street", EntityProperty: "street"},
+					{Property: "city", EntityProperty: "city"},
+				},
+			}},
+			{Property: "orders", EntityProperty: "orders", SubMapping: &OutgoingMappingConfig{
+				BaseURI:     "http://data.example.com/orders/schema/",
+				DefaultType: "http://data.example.com/orders/schema/Order",
+				Filter:      "cost > 0",
+				PropertyMappings: []*ItemToEntityPropertyMapping{
+					{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/orders/{value}"},
+					{Property: "cost", EntityProperty: "cost", Datatype: "double"},
+				},
+			}},
+		},
+	}
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "1")
+	item.SetValue("address", map[string]any{"street": "Evergreen Terrace 742", "city": "Springfield"})
+	item.SetValue("orders", []any{
+		map[string]any{"id": "10", "cost": "100.5"},
+		map[string]any{"id": "11", "cost": 0},
+		map[string]any{"id": "12", "cost": 7},
+	})
+
+	mapper := NewMapper(logger, nil, outgoingConfig)
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	address, ok := entity.Properties["http://data.example.com/schema/address"].(*egdm.Entity)
+	if !ok || address.Properties["http://data.example.com/schema/city"] != "Springfield" {
+		t.Fatalf("expected address sub-entity, got %v", entity.Properties["http://data.example.com/schema/address"])
+	}
+	orders, ok := entity.Properties["http://data.example.com/schema/orders"].([]*egdm.Entity)
+	if !ok || len(orders) != 2 {
+		t.Fatalf("expected two order sub-entities, got %v", entity.Properties["http://data.example.com/schema/orders"])
+	}
+	if orders[0].ID != "http://data.example.com/orders/10" || orders[0].Properties["http://data.example.com/orders/schema/cost"] != 100.5 ||
+		orders[0].References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] != "http://data.example.com/orders/schema/Order" {
+		t.Errorf("unexpected order %+v", orders[0])
+	}
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "address", EntityProperty: "address", SubMapping: &IncomingMappingConfig{
+				PropertyMappings: []*EntityToItemPropertyMapping{
+					{Property: "city", EntityProperty: "city"},
+				},
+			}},
+			{Property: "orders", EntityProperty: "orders", SubMapping: &IncomingMappingConfig{
+				BaseURI: "http://data.example.com/orders/schema/",
+				PropertyMappings: []*EntityToItemPropertyMapping{
+					{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/orders/{value}"},
+					{Property: "cost", EntityProperty: "cost", Datatype: "string"},
+				},
+			}},
+		},
+	}
+	// sub-entities parsed from json are lists of any
+	entity.Properties["http://data.example.com/schema/orders"] = []any{orders[0], orders[1]}
+	result := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, result); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"id":      "1",
+		"address": map[string]any{"city": "Springfield"},
+		"orders":  []any{map[string]any{"id": "10", "cost": "100.5"}, map[string]any{"id": "12", "cost": "7"}},
+	}
+	if !reflect.DeepEqual(result.properties, expected) {
+		t.Errorf("expected %v, got %v", expected, result.properties)
+	}
+
+	// the parent base uri is used without changing the sub mapping configs
+	if outgoingConfig.PropertyMappings[1].SubMapping.BaseURI != "" || incomingConfig.PropertyMappings[1].SubMapping.BaseURI != "" {
+		t.Errorf("expected sub mapping configs to be unchanged")
+	}
+
+	outgoingConfig.PropertyMappings[1].Datatype = "string"
+	if NewMapper(logger, nil, outgoingConfig).Err() == nil {
+		t.Errorf("expected sub_mapping with datatype to be invalid")
+	}
+}
+
+func TestMapFilteredNestedObject(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "address", EntityProperty: "address", SubMapping: &OutgoingMappingConfig{
+				Filter:           "city == 'Springfield'",
+				PropertyMappings: []*ItemToEntityPropertyMapping{{Property: "city", EntityProperty: "city"}},
+			}},
+			{Property: "address", EntityProperty: "addresses", ListFormat: ListFormat{IsList: true}, SubMapping: &OutgoingMappingConfig{
+				Filter:           "city == 'Springfield'",
+				PropertyMappings: []*ItemToEntityPropertyMapping{{Property: "city", EntityProperty: "city"}},
+			}},
+		},
+	}
+	item := MapItem{"id": "1", "address": map[string]any{"city": "Shelbyville"}}
+	entity := egdm.NewEntity()
+	if err := NewMapper(logger, nil, outgoingConfig).MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID != "http://data.example.com/people/1" {
+		t.Errorf("expected the parent entity to be mapped, got %s", entity.ID)
+	}
+	if _, ok := entity.Properties["http://data.example.com/schema/address"]; ok {
+		t.Errorf("expected filtered address to be left out, got %v", entity.Properties)
+	}
+	if addresses, ok := entity.Properties["http://data.example.com/schema/addresses"].([]*egdm.Entity); !ok || len(addresses) != 0 {
+		t.Errorf("expected empty list for filtered list address, got %v", entity.Properties["http://data.example.com/schema/addresses"])
+	}
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "address", EntityProperty: "address", SubMapping: &IncomingMappingConfig{
+				Filter:           "city == 'Springfield'",
+				PropertyMappings: []*EntityToItemPropertyMapping{{Property: "city", EntityProperty: "city"}},
+			}},
+		},
+	}
+	address := egdm.NewEntity()
+	address.SetProperty("http://data.example.com/schema/city", "Shelbyville")
+	entity.Properties["http://data.example.com/schema/address"] = address
+	result := MapItem{}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, MapItem{"id": "1"}) {
+		t.Errorf("expected filtered address to be left out, got %v", result)
+	}
+}
@@ -0,0 +1,90 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// Mapping configs can declare namespaces, a map of prefixes to expansions. Entity properties,
+// uri value patterns and the default type can then be given as CURIEs, e.g. foaf:name.
+
+// defaultNamespacePrefix is the prefix of the default namespace in entity contexts
+const defaultNamespacePrefix = "_"
+
+// isFullURI returns true for absolute http(s) and urn identifiers
+func isFullURI(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") || strings.HasPrefix(value, "urn:")
+}
+
+// expandCURIE expands value if it starts with a declared prefix followed by a colon
+func expandCURIE(value string, namespaces map[string]string) (string, bool) {
+	prefix, local, found := strings.Cut(value, ":")
+	if !found {
+		return value, false
+	}
+	expansion, ok := namespaces[prefix]
+	if !ok {
+		return value, false
+	}
+	return expansion + local, true
+}
+
+// curiePrefix matches the prefix of values in the prefix:local form
+var curiePrefix = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.-]*):`)
+
+// checkPrefix returns an error if value is in the prefix:local form with a prefix that is not
+// declared. Such values would otherwise be taken as relative to the base uri, hiding typos in the
+// prefix. Full uris and uris with an authority, like ftp://host, are not CURIEs.
+func checkPrefix(value string, namespaces map[string]string) error {
+	match := curiePrefix.FindStringSubmatch(value)
+	if match == nil || isFullURI(value) || strings.HasPrefix(value[len(match[0]):], "//") {
+		return nil
+	}
+	if _, ok := namespaces[match[1]]; !ok {
+		return fmt.Errorf("namespace prefix '%s' of '%s' is not declared", match[1], value)
+	}
+	return nil
+}
+
+// resolveURI returns value as full uri. CURIEs with declared prefixes are expanded, full uris are
+// kept and other values are relative to baseURI. ok is false if value is relative and there is no
+// base uri.
+func resolveURI(value string, baseURI string, namespaces map[string]string) (string, bool) {
+	if expanded, ok := expandCURIE(value, namespaces); ok {
+		return expanded, true
+	}
+	if isFullURI(value) {
+		return value, true
+	}
+	if baseURI == "" {
+		return value, false
+	}
+	return baseURI + value, true
+}
+
+// namespaceContext builds the entity context with the declared namespaces and baseURI as default namespace
+func namespaceContext(baseURI string, namespaces map[string]string) *egdm.Context {
+	context := egdm.NewContext()
+	for prefix, expansion := range namespaces {
+		context.Namespaces[prefix] = expansion
+	}
+	if _, ok := context.Namespaces[defaultNamespacePrefix]; !ok && baseURI != "" {
+		context.Namespaces[defaultNamespacePrefix] = baseURI
+	}
+	return context
+}
+
+// Context returns the namespace context of the entities produced by the mapper, with the declared
+// namespaces and the base uri as default namespace. Entity iterators return it from Context.
+func (mapper *Mapper) Context() *egdm.Context {
+	if mapper.outgoingMappingConfig != nil {
+		return namespaceContext(mapper.outgoingMappingConfig.BaseURI, mapper.outgoingMappingConfig.Namespaces)
+	}
+	if mapper.incomingMappingConfig != nil {
+		return namespaceContext(mapper.incomingMappingConfig.BaseURI, mapper.incomingMappingConfig.Namespaces)
+	}
+	return egdm.NewContext()
+}
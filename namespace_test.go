@@ -0,0 +1,153 @@
+package common_datalayer
+
+import (
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestMapWithNamespaces(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	namespaces := map[string]string{
+		"foaf":   "http://xmlns.com/foaf/0.1/",
+		"people": "http://data.example.com/people/",
+	}
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI:     "http://data.example.com/schema/",
+		Namespaces:  namespaces,
+		DefaultType: "foaf:Person",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "people:{value}"},
+			{Property: "name", EntityProperty: "foaf:name"},
+			{Property: "friend", EntityProperty: "foaf:knows", IsReference: true, URIValuePattern: "people:{value}"},
+			{Property: "age", EntityProperty: "age"},
+			{Property: "homepage", EntityProperty: "http://schema.org/url"},
+		},
+	}
+	item := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	item.SetValue("id", "1")
+	item.SetValue("name", "Homer")
+	item.SetValue("friend", "2")
+	item.SetValue("age", 39)
+	item.SetValue("homepage", "http://simpsons.example.com")
+
+	mapper := NewMapper(logger, nil, outgoingConfig)
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID != "http://data.example.com/people/1" {
+		t.Errorf("unexpected id %s", entity.ID)
+	}
+	if entity.Properties["http://xmlns.com/foaf/0.1/name"] != "Homer" {
+		t.Errorf("expected foaf:name to be expanded, got %v", entity.Properties)
+	}
+	if entity.Properties["http://data.example.com/schema/age"] != 39 {
+		t.Errorf("expected age to be relative to base uri, got %v", entity.Properties)
+	}
+	if entity.Properties["http://schema.org/url"] != "http://simpsons.example.com" {
+		t.Errorf("expected full uri to be kept, got %v", entity.Properties)
+	}
+	if entity.References["http://xmlns.com/foaf/0.1/knows"] != "http://data.example.com/people/2" {
+		t.Errorf("unexpected references %v", entity.References)
+	}
+	if entity.References["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"] != "http://xmlns.com/foaf/0.1/Person" {
+		t.Errorf("expected default type to be expanded, got %v", entity.References)
+	}
+
+	context := mapper.Context()
+	if context.ID != "@context" || len(context.Namespaces) != 3 ||
+		context.Namespaces["foaf"] != "http://xmlns.com/foaf/0.1/" ||
+		context.Namespaces["_"] != "http://data.example.com/schema/" {
+		t.Errorf("unexpected context %+v", context)
+	}
+
+	incomingConfig := &IncomingMappingConfig{
+		BaseURI:    "http://data.example.com/schema/",
+		Namespaces: namespaces,
+		PropertyMappings: []*EntityToItemPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "people:{value}"},
+			{Property: "name", EntityProperty: "foaf:name"},
+			{Property: "friend", EntityProperty: "foaf:knows", IsReference: true, URIValuePattern: "people:{value}"},
+			{Property: "age", EntityProperty: "age"},
+		},
+	}
+	result := &InMemoryItem{properties: make(map[string]interface{}), propertyNames: make([]string, 0)}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.GetValue("id") != "1" || result.GetValue("name") != "Homer" ||
+		result.GetValue("friend") != "2" || result.GetValue("age") != 39 {
+		t.Errorf("unexpected item %v", result.properties)
+	}
+}
+
+func TestResolveURI(t *testing.T) {
+	namespaces := map[string]string{"foaf": "http://xmlns.com/foaf/0.1/"}
+	tests := []struct {
+		value, baseURI, expected string
+		ok                       bool
+	}{
+		{"foaf:name", "", "http://xmlns.com/foaf/0.1/name", true},
+		{"name", "http://data.example.com/", "http://data.example.com/name", true},
+		{"name", "", "name", false},
+		{"https://schema.org/name", "", "https://schema.org/name", true},
+		{"urn:isbn:0451450523", "", "urn:isbn:0451450523", true},
+		{"dc:title", "http://data.example.com/", "http://data.example.com/dc:title", true},
+	}
+	for _, test := range tests {
+		uri, ok := resolveURI(test.value, test.baseURI, namespaces)
+		if uri != test.expected || ok != test.ok {
+			t.Errorf("resolveURI(%s, %s) = %s, %v, expected %s, %v", test.value, test.baseURI, uri, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestUndeclaredPrefixesAreRejected(t *testing.T) {
+	namespaces := map[string]string{"foaf": "http://xmlns.com/foaf/0.1/"}
+	for value, valid := range map[string]bool{
+		"foaf:name": true, "name": true, "https://schema.org/name": true, "urn:isbn:0451450523": true,
+		"ftp://example.com/name": true, "{value}": true, "foa:name": false, "dc:title": false,
+	} {
+		if err := checkPrefix(value, namespaces); (err == nil) != valid {
+			t.Errorf("%s: expected valid %v, got %v", value, valid, err)
+		}
+	}
+
+	logger := NewLogger("testService", "text", "info")
+	outgoing := func(configure func(config *OutgoingMappingConfig)) *Mapper {
+		config := &OutgoingMappingConfig{
+			BaseURI:    "http://data.example.com/schema/",
+			Namespaces: namespaces,
+			PropertyMappings: []*ItemToEntityPropertyMapping{
+				{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			},
+		}
+		configure(config)
+		return NewMapper(logger, nil, config)
+	}
+	mappers := map[string]*Mapper{
+		"entity_property": outgoing(func(config *OutgoingMappingConfig) {
+			config.PropertyMappings = append(config.PropertyMappings, &ItemToEntityPropertyMapping{Property: "name", EntityProperty: "foa:name"})
+		}),
+		"inverse_entity_property": outgoing(func(config *OutgoingMappingConfig) {
+			config.PropertyMappings = append(config.PropertyMappings, &ItemToEntityPropertyMapping{Property: "friend", EntityProperty: "foaf:knows", IsReference: true, InverseEntityProperty: "foa:knownBy"})
+		}),
+		"uri_value_pattern": outgoing(func(config *OutgoingMappingConfig) {
+			config.PropertyMappings[0].URIValuePattern = "people:{value}"
+		}),
+		"default_type": outgoing(func(config *OutgoingMappingConfig) { config.DefaultType = "foa:Person" }),
+		"provenance":   outgoing(func(config *OutgoingMappingConfig) { config.Provenance = &ProvenanceConfig{MappedAt: "prov:mappedAt"} }),
+		"incoming entity_property": NewMapper(logger, &IncomingMappingConfig{
+			BaseURI:          "http://data.example.com/schema/",
+			Namespaces:       namespaces,
+			PropertyMappings: []*EntityToItemPropertyMapping{{Property: "name", EntityProperty: "foa:name"}},
+		}, nil),
+	}
+	for name, mapper := range mappers {
+		if err := mapper.Err(); err == nil || !strings.Contains(err.Error(), "is not declared") {
+			t.Errorf("%s: expected undeclared prefix error, got %v", name, err)
+		}
+	}
+}
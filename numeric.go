@@ -0,0 +1,203 @@
+package common_datalayer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// lossless datatypes supported in property mappings
+const (
+	DatatypeDecimal = "decimal"
+	DatatypeBigInt  = "bigint"
+	DatatypeUUID    = "uuid"
+)
+
+var decimalDatatypePattern = regexp.MustCompile(`^decimal(?:\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\))?$`)
+
+// decimalType is a parsed decimal(precision,scale) datatype. A precision or scale of -1 means unconstrained.
+type decimalType struct {
+	precision int
+	scale     int
+}
+
+// parseDecimalDatatype parses decimal, decimal(p) and decimal(p,s). ok is false if datatype is not a decimal.
+func parseDecimalDatatype(datatype string) (decimalType, bool, error) {
+	match := decimalDatatypePattern.FindStringSubmatch(datatype)
+	if match == nil {
+		if strings.HasPrefix(datatype, DatatypeDecimal) {
+			return decimalType{}, false, fmt.Errorf("invalid decimal datatype '%s', expected decimal(precision,scale)", datatype)
+		}
+		return decimalType{}, false, nil
+	}
+	d := decimalType{precision: -1, scale: -1}
+	if match[1] != "" {
+		d.precision, _ = strconv.Atoi(match[1])
+		d.scale = 0
+		if d.precision == 0 {
+			return decimalType{}, false, fmt.Errorf("invalid decimal datatype '%s', precision must be positive", datatype)
+		}
+	}
+	if match[2] != "" {
+		d.scale, _ = strconv.Atoi(match[2])
+		if d.scale > d.precision {
+			return decimalType{}, false, fmt.Errorf("invalid decimal datatype '%s', scale must not exceed precision", datatype)
+		}
+	}
+	return d, true, nil
+}
+
+// ratOfValue converts numbers, numeric strings and math/big values to an exact rational number.
+// Floats are converted from their shortest decimal representation, so 0.1 becomes 1/10.
+func ratOfValue(val any) (*big.Rat, error) {
+	r := new(big.Rat)
+	switch v := val.(type) {
+	case nil:
+		return nil, fmt.Errorf("value is nil")
+	case *big.Rat:
+		return r.Set(v), nil
+	case *big.Int:
+		return r.SetInt(v), nil
+	case *big.Float:
+		if _, ok := r.SetString(v.Text('f', -1)); !ok {
+			return nil, fmt.Errorf("value %v is not a finite number", v)
+		}
+		return r, nil
+	case float32:
+		return ratOfValue(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	case float64:
+		return ratOfValue(strconv.FormatFloat(v, 'f', -1, 64))
+	case json.Number:
+		return ratOfValue(string(v))
+	case string:
+		if _, ok := r.SetString(strings.TrimSpace(v)); !ok {
+			return nil, fmt.Errorf("'%s' is not a number", v)
+		}
+		return r, nil
+	case uint:
+		return r.SetInt(new(big.Int).SetUint64(uint64(v))), nil
+	case uint64:
+		return r.SetInt(new(big.Int).SetUint64(v)), nil
+	}
+	i, err := int64OfValue(val)
+	if err != nil {
+		return nil, fmt.Errorf("value %v of type %T is not a number", val, val)
+	}
+	return r.SetInt64(i), nil
+}
+
+// fractionDigits returns the number of decimals needed to represent r exactly, or -1 if r has no
+// finite decimal representation
+func fractionDigits(r *big.Rat) int {
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for denom.Cmp(big.NewInt(1)) != 0 {
+		if mod.Mod(denom, two).Sign() == 0 {
+			denom.Quo(denom, two)
+			twos++
+		} else if mod.Mod(denom, five).Sign() == 0 {
+			denom.Quo(denom, five)
+			fives++
+		} else {
+			return -1
+		}
+	}
+	return max(twos, fives)
+}
+
+// decimalOfValue converts val to a decimal number with the scale of the datatype, rounding half away
+// from zero. The result is a json.Number, which keeps all digits when serialised. An error is
+// returned if the value has more integer digits than precision minus scale allows.
+func decimalOfValue(val any, d decimalType) (json.Number, error) {
+	r, err := ratOfValue(val)
+	if err != nil {
+		return "", err
+	}
+	scale := d.scale
+	if scale < 0 {
+		scale = fractionDigits(r)
+		if scale < 0 {
+			return "", fmt.Errorf("value %v has no exact decimal representation", val)
+		}
+	}
+	s := r.FloatString(scale)
+	if d.precision > 0 {
+		integerPart := strings.TrimLeft(strings.SplitN(strings.TrimPrefix(s, "-"), ".", 2)[0], "0")
+		if len(integerPart) > d.precision-scale {
+			return "", fmt.Errorf("value %s does not fit decimal(%d,%d)", s, d.precision, d.scale)
+		}
+	}
+	return json.Number(s), nil
+}
+
+// stringOfBigValue formats math/big values without loss, ok is false for other types
+func stringOfBigValue(val any) (string, bool) {
+	switch v := val.(type) {
+	case *big.Int:
+		return v.String(), true
+	case *big.Float:
+		return v.Text('f', -1), true
+	case *big.Rat:
+		if digits := fractionDigits(v); digits >= 0 {
+			return v.FloatString(digits), true
+		}
+		return v.RatString(), true
+	}
+	return "", false
+}
+
+// bigIntOfValue converts integral values of any size to *big.Int
+func bigIntOfValue(val any) (*big.Int, error) {
+	if i, ok := val.(*big.Int); ok {
+		return new(big.Int).Set(i), nil
+	}
+	r, err := ratOfValue(val)
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsInt() {
+		return nil, fmt.Errorf("value %v is not an integer", val)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// uuidOfValue returns the canonical lowercase form of a uuid given as string, with or without
+// hyphens, braces or urn:uuid: prefix, or as 16 bytes
+func uuidOfValue(val any) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", fmt.Errorf("value is nil")
+	case []byte:
+		if len(v) == 16 {
+			return uuid.FormatUUID(v)
+		}
+		return uuidOfValue(string(v))
+	case [16]byte:
+		return uuid.FormatUUID(v[:])
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		s = strings.TrimPrefix(s, "urn:uuid:")
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+		if len(s) == 32 {
+			if _, err := hex.DecodeString(s); err == nil {
+				s = s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+			}
+		}
+		if _, err := uuid.ParseUUID(s); err != nil {
+			return "", fmt.Errorf("'%s' is not a valid uuid", v)
+		}
+		return s, nil
+	}
+	if s, ok := val.(fmt.Stringer); ok {
+		return uuidOfValue(s.String())
+	}
+	return "", fmt.Errorf("value %v of type %T is not a uuid", val, val)
+}
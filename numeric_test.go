@@ -0,0 +1,129 @@
+package common_datalayer
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestDecimalOfValue(t *testing.T) {
+	tests := []struct {
+		datatype string
+		value    any
+		expected json.Number
+	}{
+		{datatype: "decimal(10,2)", value: json.Number("12345678.905"), expected: "12345678.91"},
+		{datatype: "decimal(10,2)", value: "-0.5", expected: "-0.50"},
+		{datatype: "decimal(10,2)", value: 0.1, expected: "0.10"},
+		{datatype: "decimal(5)", value: 12345, expected: "12345"},
+		{datatype: "decimal", value: "123456789012345678901234567890.123456789", expected: "123456789012345678901234567890.123456789"},
+		{datatype: "decimal", value: 0.30000000000000004, expected: "0.30000000000000004"},
+		{datatype: "decimal", value: big.NewRat(1, 8), expected: "0.125"},
+		{datatype: "decimal( 4 , 4 )", value: "0.12345", expected: "0.1235"},
+	}
+	for _, test := range tests {
+		d, ok, err := parseDecimalDatatype(test.datatype)
+		if err != nil || !ok {
+			t.Errorf("%s: expected decimal datatype, got %v", test.datatype, err)
+			continue
+		}
+		value, err := decimalOfValue(test.value, d)
+		if err != nil {
+			t.Errorf("%s %v: unexpected error %v", test.datatype, test.value, err)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("%s %v: expected %s, got %s", test.datatype, test.value, test.expected, value)
+		}
+	}
+
+	d, _, _ := parseDecimalDatatype("decimal(5,2)")
+	if _, err := decimalOfValue("1234.5", d); err == nil {
+		t.Error("value with too many integer digits should fail")
+	}
+	if _, err := decimalOfValue("abc", d); err == nil {
+		t.Error("non numeric value should fail")
+	}
+	if _, err := decimalOfValue(big.NewRat(1, 3), decimalType{precision: -1, scale: -1}); err == nil {
+		t.Error("value without exact decimal representation should fail without scale")
+	}
+	for _, datatype := range []string{"decimal(2,3)", "decimal(0)", "decimal(a,b)"} {
+		if _, _, err := parseDecimalDatatype(datatype); err == nil {
+			t.Errorf("%s: expected error", datatype)
+		}
+	}
+	if _, ok, _ := parseDecimalDatatype("double"); ok {
+		t.Error("double is not a decimal")
+	}
+}
+
+func TestBigIntAndUUIDOfValue(t *testing.T) {
+	i, err := bigIntOfValue(json.Number("123456789012345678901234567890"))
+	if err != nil || i.String() != "123456789012345678901234567890" {
+		t.Errorf("expected big integer, got %v %v", i, err)
+	}
+	if _, err := bigIntOfValue("1.5"); err == nil {
+		t.Error("non integral value should fail")
+	}
+	if _, err := int64OfValue(i); err == nil {
+		t.Error("big integer out of int64 range should fail for long")
+	}
+	for _, value := range []any{1.7, float32(-0.5), 1e19, uint64(math.MaxUint64)} {
+		if n, err := int64OfValue(value); err == nil {
+			t.Errorf("%v: expected error for long, got %d", value, n)
+		}
+	}
+	if _, err := int32OfValue(2.5); err == nil {
+		t.Error("float with fraction should fail for int")
+	}
+	if n, err := int64OfValue(42.0); err != nil || n != 42 {
+		t.Errorf("whole float should convert to long, got %d %v", n, err)
+	}
+
+	for _, value := range []any{
+		"F47AC10B-58CC-4372-A567-0E02B2C3D479",
+		"urn:uuid:f47ac10b-58cc-4372-a567-0e02b2c3d479",
+		"{f47ac10b58cc4372a5670e02b2c3d479}",
+		[]byte{0xf4, 0x7a, 0xc1, 0x0b, 0x58, 0xcc, 0x43, 0x72, 0xa5, 0x67, 0x0e, 0x02, 0xb2, 0xc3, 0xd4, 0x79},
+	} {
+		u, err := uuidOfValue(value)
+		if err != nil || u != "f47ac10b-58cc-4372-a567-0e02b2c3d479" {
+			t.Errorf("%v: expected canonical uuid, got %s %v", value, u, err)
+		}
+	}
+	if _, err := uuidOfValue("not-a-uuid"); err == nil {
+		t.Error("invalid uuid should fail")
+	}
+}
+
+func TestStringOfValueIsLossless(t *testing.T) {
+	tests := map[any]string{
+		1.5:                        "1.5",
+		float32(0.1):               "0.1",
+		123456789.123456789:        "123456789.12345679",
+		json.Number("1.10"):        "1.10",
+		big.NewInt(1 << 62):        "4611686018427387904",
+		"9223372036854775807":      "9223372036854775807",
+		new(big.Float).SetInt64(3): "3",
+	}
+	for value, expected := range tests {
+		s, err := stringOfValue(value)
+		if err != nil || s != expected {
+			t.Errorf("%v: expected %s, got %s %v", value, expected, s, err)
+		}
+	}
+}
+
+func TestFloat32OfValue(t *testing.T) {
+	for _, value := range []any{0, -1.5, "-2.25", float32(-math.MaxFloat32), 1e-50} {
+		if _, err := float32OfValue(value); err != nil {
+			t.Errorf("%v: unexpected error %v", value, err)
+		}
+	}
+	for _, value := range []any{math.MaxFloat64, -math.MaxFloat64, "1e39"} {
+		if _, err := float32OfValue(value); err == nil {
+			t.Errorf("%v: expected out of range error", value)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Property paths address values in nested item structures. A path starts with $ and is
+// followed by any number of segments:
+//
+//	.name or ['name']  map key
+//	[0]                array index, negative indexes count from the end
+//	[*] or .*          all array elements or map values, produces a list
+//
+// Example: $.names[0].firstname, $.addresses[*].city
+//
+// Dotted names without the $ prefix, e.g. names.firstname, are also evaluated as paths when
+// reading, but only if the item has no property with that exact name.
+
+type pathSegmentKind int
+
+const (
+	pathKey pathSegmentKind = iota
+	pathIndex
+	pathWildcard
+)
+
+type pathSegment struct {
+	kind  pathSegmentKind
+	key   string
+	index int
+}
+
+type propertyPath struct {
+	expr     string
+	segments []pathSegment
+}
+
+var propertyPathCache sync.Map
+
+// isPropertyPath returns true if name must be treated as a path expression
+func isPropertyPath(name string) bool {
+	return strings.HasPrefix(name, "$.") || strings.HasPrefix(name, "$[")
+}
+
+// mayBePropertyPath returns true if name can be evaluated as a path when no property with that name exists
+func mayBePropertyPath(name string) bool {
+	return strings.ContainsAny(name, ".[")
+}
+
+func compilePropertyPath(expr string) (*propertyPath, error) {
+	if p, ok := propertyPathCache.Load(expr); ok {
+		return p.(*propertyPath), nil
+	}
+	p, err := parsePropertyPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	propertyPathCache.Store(expr, p)
+	return p, nil
+}
+
+func parsePropertyPath(expr string) (*propertyPath, error) {
+	p := &propertyPath{expr: expr}
+	s := expr
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else {
+		// bare first segment
+		end := strings.IndexAny(s, ".[")
+		if end == -1 {
+			end = len(s)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("invalid path '%s': expected property name at start", expr)
+		}
+		p.segments = append(p.segments, pathSegment{kind: pathKey, key: s[:end]})
+		s = s[end:]
+	}
+
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path '%s': empty property name", expr)
+			}
+			if s[:end] == "*" {
+				p.segments = append(p.segments, pathSegment{kind: pathWildcard})
+			} else {
+				p.segments = append(p.segments, pathSegment{kind: pathKey, key: s[:end]})
+			}
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("invalid path '%s': missing ]", expr)
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+			switch {
+			case inner == "*":
+				p.segments = append(p.segments, pathSegment{kind: pathWildcard})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p.segments = append(p.segments, pathSegment{kind: pathKey, key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path '%s': invalid index '%s'", expr, inner)
+				}
+				p.segments = append(p.segments, pathSegment{kind: pathIndex, index: i})
+			}
+		default:
+			return nil, fmt.Errorf("invalid path '%s': unexpected character '%c'", expr, s[0])
+		}
+	}
+
+	if len(p.segments) == 0 {
+		return nil, fmt.Errorf("invalid path '%s': no segments", expr)
+	}
+	if p.segments[0].kind != pathKey {
+		return nil, fmt.Errorf("invalid path '%s': path must start with a property name", expr)
+	}
+	return p, nil
+}
+
+func (p *propertyPath) hasWildcard() bool {
+	for _, seg := range p.segments {
+		if seg.kind == pathWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// get evaluates the path against the item. If the path contains wildcards the result is
+// a []any of all matched values, otherwise the single value or nil if not found.
+func (p *propertyPath) get(item Item) any {
+	current := []any{item.GetValue(p.segments[0].key)}
+	for _, seg := range p.segments[1:] {
+		next := make([]any, 0, len(current))
+		for _, v := range current {
+			switch seg.kind {
+			case pathKey:
+				if child, ok := childByKey(v, seg.key); ok {
+					next = append(next, child)
+				}
+			case pathIndex:
+				if child, ok := childByIndex(v, seg.index); ok {
+					next = append(next, child)
+				}
+			case pathWildcard:
+				next = append(next, children(v)...)
+			}
+		}
+		current = next
+	}
+
+	if p.hasWildcard() {
+		return current
+	}
+	if len(current) == 0 {
+		return nil
+	}
+	return current[0]
+}
+
+// set assigns value at the path, creating intermediate maps and arrays as needed. For
+// wildcard segments a list value is distributed element wise, other values are assigned to
+// every element.
+func (p *propertyPath) set(item Item, value any) error {
+	root := p.segments[0].key
+	if len(p.segments) == 1 {
+		item.SetValue(root, value)
+		return nil
+	}
+	updated, err := setPathValue(item.GetValue(root), p.segments[1:], value)
+	if err != nil {
+		return fmt.Errorf("failed to set value at path '%s': %w", p.expr, err)
+	}
+	item.SetValue(root, updated)
+	return nil
+}
+
+func setPathValue(container any, segments []pathSegment, value any) (any, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	seg := segments[0]
+	rest := segments[1:]
+
+	switch seg.kind {
+	case pathKey:
+		if i, ok := container.(Item); ok {
+			updated, err := setPathValue(i.GetValue(seg.key), rest, value)
+			if err != nil {
+				return nil, err
+			}
+			i.SetValue(seg.key, updated)
+			return i, nil
+		}
+		if container == nil {
+			container = make(map[string]any)
+		}
+		m, ok := container.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot set key '%s' on value of type %T", seg.key, container)
+		}
+		updated, err := setPathValue(m[seg.key], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		m[seg.key] = updated
+		return m, nil
+	case pathIndex:
+		list, err := asAnySlice(container)
+		if err != nil {
+			return nil, err
+		}
+		index := seg.index
+		if index < 0 {
+			index = len(list) + index
+			if index < 0 {
+				return nil, fmt.Errorf("index %d out of range", seg.index)
+			}
+		}
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		list[index], err = setPathValue(list[index], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		return list, nil
+	default:
+		list, err := asAnySlice(container)
+		if err != nil {
+			return nil, err
+		}
+		if values, ok := asList(value); ok {
+			for len(list) < len(values) {
+				list = append(list, nil)
+			}
+			for i, v := range values {
+				list[i], err = setPathValue(list[i], rest, v)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return list, nil
+		}
+		for i := range list {
+			list[i], err = setPathValue(list[i], rest, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+}
+
+func asAnySlice(v any) ([]any, error) {
+	if v == nil {
+		return make([]any, 0), nil
+	}
+	if list, ok := v.([]any); ok {
+		return list, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot index value of type %T", v)
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, nil
+}
+
+// asList returns the elements of slices and arrays, except []byte
+func asList(v any) ([]any, bool) {
+	switch l := v.(type) {
+	case nil, []byte, string:
+		return nil, false
+	case []any:
+		return l, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+func childByKey(v any, key string) (any, bool) {
+	switch c := v.(type) {
+	case nil:
+		return nil, false
+	case map[string]any:
+		child, ok := c[key]
+		return child, ok
+	case Item:
+		child := c.GetValue(key)
+		return child, child != nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		child := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if child.IsValid() {
+			return child.Interface(), true
+		}
+	}
+	return nil, false
+}
+
+func childByIndex(v any, index int) (any, bool) {
+	list, ok := asList(v)
+	if !ok {
+		return nil, false
+	}
+	if index < 0 {
+		index = len(list) + index
+	}
+	if index < 0 || index >= len(list) {
+		return nil, false
+	}
+	return list[index], true
+}
+
+// children returns the elements of lists and the values of maps, ordered by key
+func children(v any) []any {
+	if list, ok := asList(v); ok {
+		return list
+	}
+	switch c := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]any, len(keys))
+		for i, k := range keys {
+			values[i] = c[k]
+		}
+		return values
+	case Item:
+		// sort a copy, items may return names they keep
+		names := slices.Clone(c.GetPropertyNames())
+		sort.Strings(names)
+		values := make([]any, 0, len(names))
+		for _, name := range names {
+			values = append(values, c.GetValue(name))
+		}
+		return values
+	}
+	return nil
+}
+
+// getItemValue returns the value of the named property, evaluating path expressions
+func getItemValue(item Item, name string) (any, error) {
+	if isPropertyPath(name) {
+		p, err := compilePropertyPath(name)
+		if err != nil {
+			return nil, err
+		}
+		return p.get(item), nil
+	}
+	value := item.GetValue(name)
+	if value == nil && mayBePropertyPath(name) {
+		p, err := compilePropertyPath(name)
+		if err != nil {
+			// not a valid path, so it is just a missing property
+			return nil, nil
+		}
+		return p.get(item), nil
+	}
+	return value, nil
+}
+
+// setItemValue sets the value of the named property, creating nested structures for path expressions
+func setItemValue(item Item, name string, value any) error {
+	if isPropertyPath(name) {
+		p, err := compilePropertyPath(name)
+		if err != nil {
+			return err
+		}
+		return p.set(item, value)
+	}
+	item.SetValue(name, value)
+	return nil
+}
@@ -0,0 +1,78 @@
+package common_datalayer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPropertyPathGet(t *testing.T) {
+	item := &InMemoryItem{properties: map[string]any{
+		"names": []any{
+			map[string]any{"firstname": "homer", "lastname": "simpson"},
+			map[string]any{"firstname": "max", "lastname": "power"},
+		},
+		"address": map[string]any{"city": "springfield", "zip": []string{"123", "456"}},
+		"a.b":     "flat",
+	}}
+
+	tests := []struct {
+		path     string
+		expected any
+	}{
+		{path: "$.names[0].firstname", expected: "homer"},
+		{path: "$.names[-1].lastname", expected: "power"},
+		{path: "$['address']['city']", expected: "springfield"},
+		{path: "$.address.zip[1]", expected: "456"},
+		{path: "$.names[*].firstname", expected: []any{"homer", "max"}},
+		{path: "$.address.*", expected: []any{"springfield", []string{"123", "456"}}},
+		{path: "$.names[5].firstname", expected: nil},
+		{path: "address.city", expected: "springfield"},
+		{path: "a.b", expected: "flat"},
+	}
+	for _, test := range tests {
+		value, err := getItemValue(item, test.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.path, test.expected, value)
+		}
+	}
+}
+
+func TestPropertyPathSet(t *testing.T) {
+	item := &InMemoryItem{properties: make(map[string]any)}
+
+	if err := setItemValue(item, "$.names[1].firstname", "max"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setItemValue(item, "$.tags[*].name", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setItemValue(item, "a.b", "flat"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"names": []any{nil, map[string]any{"firstname": "max"}},
+		"tags":  []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}},
+		"a.b":   "flat",
+	}
+	if !reflect.DeepEqual(item.properties, expected) {
+		t.Errorf("expected %v, got %v", expected, item.properties)
+	}
+
+	item.SetValue("scalar", "x")
+	if err := setItemValue(item, "$.scalar.name", "y"); err == nil {
+		t.Error("setting a key on a scalar value should fail")
+	}
+}
+
+func TestParsePropertyPathErrors(t *testing.T) {
+	for _, path := range []string{"$", "$.", "$[1", "$[abc]", "$[0].name", "$..name"} {
+		if _, err := parsePropertyPath(path); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
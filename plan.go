@@ -0,0 +1,382 @@
+package common_datalayer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// outgoingPlan is the compiled form of an OutgoingMappingConfig
+type outgoingPlan struct {
+	constructions  []*construction
+	filter         *expression
+	deleteFiltered bool
+	mappings       []*outgoingMapping
+	defaultType    string
+	provenance     *provenancePlan // nil if the config has no provenance
+}
+
+type outgoingMapping struct {
+	*ItemToEntityPropertyMapping
+	entityProperty string      // full uri, empty if the mapping has no entity property
+	pattern        *uriPattern // nil if the mapping has no uri_value_pattern, {value} for references without one
+	composite      bool        // identity or reference built from named placeholders only
+	inverse        string      // full uri of the inverse_entity_property of references
+	condition      *expression
+	convert        converter // nil if the mapping has no datatype
+	sub            *Mapper   // maps nested objects if the mapping has a sub_mapping
+}
+
+// incomingPlan is the compiled form of an IncomingMappingConfig
+type incomingPlan struct {
+	constructions []*construction
+	filter        *expression
+	mappings      []*incomingMapping
+	named         *namedPlan // nil without map_named
+}
+
+type incomingMapping struct {
+	*EntityToItemPropertyMapping
+	entityProperty string
+	pattern        *uriPattern
+	condition      *expression
+	convert        converter
+	sub            *Mapper
+}
+
+// construction is a compiled PropertyConstructor
+type construction struct {
+	property string
+	internal bool // not written to the item by incoming mappings
+	eval     func(item Item) (any, error)
+}
+
+// converter converts a value to the datatype of a property mapping
+type converter func(value any) (any, error)
+
+func (mapper *Mapper) compile() error {
+	var err error
+	if mapper.incomingMappingConfig != nil {
+		if mapper.incoming, err = compileIncoming(mapper.logger, mapper.lookups, mapper.incomingMappingConfig); err != nil {
+			return err
+		}
+	}
+	if mapper.outgoingMappingConfig != nil {
+		if mapper.outgoing, err = compileOutgoing(mapper.logger, mapper.lookups, mapper.outgoingMappingConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileOutgoing(logger Logger, lookups *LookupTables, config *OutgoingMappingConfig) (*outgoingPlan, error) {
+	plan := &outgoingPlan{}
+	var err error
+	if plan.constructions, err = compileConstructions("outgoing", config.Constructions, lookups); err != nil {
+		return nil, err
+	}
+	if plan.filter, err = compileFilter("outgoing", config.Filter); err != nil {
+		return nil, err
+	}
+	switch config.FilterAction {
+	case "", FilterActionDrop:
+	case FilterActionDelete:
+		plan.deleteFiltered = true
+	default:
+		return nil, fmt.Errorf("outgoing filter_action '%s' is invalid, expected drop or delete", config.FilterAction)
+	}
+	if err = checkPrefix(config.DefaultType, config.Namespaces); err != nil {
+		return nil, fmt.Errorf("outgoing default_type: %w", err)
+	}
+	plan.defaultType, _ = expandCURIE(config.DefaultType, config.Namespaces)
+	if config.Provenance != nil {
+		if plan.provenance, err = compileProvenance(config); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, m := range config.PropertyMappings {
+		mapping := &outgoingMapping{ItemToEntityPropertyMapping: m}
+		invalid := func(err error) error {
+			return fmt.Errorf("outgoing mapping %d for property '%s': %w", i, m.Property, err)
+		}
+		if mapping.condition, err = compileCondition(m.Condition); err != nil {
+			return nil, invalid(err)
+		}
+		if mapping.pattern, err = compilePatternOf(m.URIValuePattern, config.Namespaces); err != nil {
+			return nil, invalid(err)
+		}
+		mapping.composite = m.Property == "" && (m.IsIdentity || m.IsReference) && mapping.pattern != nil && mapping.pattern.hasNamedPlaceholders()
+		if m.Property == "" && !mapping.composite {
+			return nil, invalid(errors.New("property name is required"))
+		}
+		if m.EntityProperty != "" {
+			if err = checkPrefix(m.EntityProperty, config.Namespaces); err != nil {
+				return nil, invalid(err)
+			}
+			var ok bool
+			if mapping.entityProperty, ok = resolveURI(m.EntityProperty, config.BaseURI, config.Namespaces); !ok {
+				return nil, invalid(fmt.Errorf("base uri is required for mapping and entity_property '%s' isnt full URI", m.EntityProperty))
+			}
+		}
+		switch {
+		case m.IsIdentity:
+			if mapping.pattern == nil {
+				return nil, invalid(errors.New("url value pattern is required for identity property"))
+			}
+		case m.IsReference:
+			if mapping.entityProperty == "" {
+				return nil, invalid(errors.New("entity property name is required for mapping"))
+			}
+			if mapping.pattern == nil {
+				// without pattern the value is the reference
+				mapping.pattern, _ = compileURIPattern("{" + valuePlaceholder + "}")
+			}
+			if m.InverseEntityProperty != "" {
+				if err = checkPrefix(m.InverseEntityProperty, config.Namespaces); err != nil {
+					return nil, invalid(err)
+				}
+				var ok bool
+				if mapping.inverse, ok = resolveURI(m.InverseEntityProperty, config.BaseURI, config.Namespaces); !ok {
+					return nil, invalid(fmt.Errorf("base uri is required for mapping and inverse_entity_property '%s' isnt full URI", m.InverseEntityProperty))
+				}
+			}
+		case m.IsDeleted, m.IsRecorded:
+		default:
+			if mapping.entityProperty == "" {
+				return nil, invalid(errors.New("entity property name is required for mapping"))
+			}
+		}
+		if m.InverseEntityProperty != "" && !m.IsReference {
+			return nil, invalid(errors.New("inverse_entity_property requires is_reference"))
+		}
+		if mapping.convert, err = newConverter(m.Datatype, m.TimeFormat); err != nil {
+			return nil, invalid(err)
+		}
+		if m.SubMapping != nil {
+			if err = validateSubMapping(m.IsIdentity, m.IsReference, m.IsDeleted, m.IsRecorded, m.Datatype, m.ListSeparator); err != nil {
+				return nil, invalid(err)
+			}
+			if mapping.sub, err = newSubMapper(logger, lookups, config.BaseURI, config.Namespaces, nil, m.SubMapping); err != nil {
+				return nil, invalid(err)
+			}
+		}
+		plan.mappings = append(plan.mappings, mapping)
+	}
+	return plan, nil
+}
+
+func compileIncoming(logger Logger, lookups *LookupTables, config *IncomingMappingConfig) (*incomingPlan, error) {
+	plan := &incomingPlan{}
+	var err error
+	if plan.constructions, err = compileConstructions("incoming", config.Constructions, lookups); err != nil {
+		return nil, err
+	}
+	if plan.filter, err = compileFilter("incoming", config.Filter); err != nil {
+		return nil, err
+	}
+
+	for i, m := range config.PropertyMappings {
+		mapping := &incomingMapping{EntityToItemPropertyMapping: m}
+		invalid := func(err error) error {
+			return fmt.Errorf("incoming mapping %d for property '%s': %w", i, m.Property, err)
+		}
+		if mapping.condition, err = compileCondition(m.Condition); err != nil {
+			return nil, invalid(err)
+		}
+		if mapping.pattern, err = compilePatternOf(m.URIValuePattern, config.Namespaces); err != nil {
+			return nil, invalid(err)
+		}
+		if m.EntityProperty != "" {
+			if err = checkPrefix(m.EntityProperty, config.Namespaces); err != nil {
+				return nil, invalid(err)
+			}
+			var ok bool
+			if mapping.entityProperty, ok = resolveURI(m.EntityProperty, config.BaseURI, config.Namespaces); !ok {
+				return nil, invalid(fmt.Errorf("base uri is required for mapping and entity_property '%s' isnt full URI", m.EntityProperty))
+			}
+		}
+		if mapping.convert, err = newConverter(m.Datatype, m.TimeFormat); err != nil {
+			return nil, invalid(err)
+		}
+		if m.SubMapping != nil {
+			if err = validateSubMapping(m.IsIdentity, m.IsReference, m.IsDeleted, m.IsRecorded, m.Datatype, m.ListSeparator); err != nil {
+				return nil, invalid(err)
+			}
+			if mapping.sub, err = newSubMapper(logger, lookups, config.BaseURI, config.Namespaces, m.SubMapping, nil); err != nil {
+				return nil, invalid(err)
+			}
+		}
+		plan.mappings = append(plan.mappings, mapping)
+	}
+	if config.MapNamed {
+		if plan.named, err = compileNamed(config, plan.mappings); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func compileCondition(condition string) (*expression, error) {
+	if condition == "" {
+		return nil, nil
+	}
+	return compileExpression(condition)
+}
+
+// compilePatternOf compiles a uri_value_pattern, which may start with a CURIE
+func compilePatternOf(pattern string, namespaces map[string]string) (*uriPattern, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if err := checkPrefix(pattern, namespaces); err != nil {
+		return nil, err
+	}
+	pattern, _ = expandCURIE(pattern, namespaces)
+	return compileURIPattern(pattern)
+}
+
+func compileFilter(direction string, filter string) (*expression, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	expr, err := compileExpression(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s filter: %w", direction, err)
+	}
+	return expr, nil
+}
+
+// applies returns false if the mapping has a condition that is not met
+func applies(condition *expression, item Item) (bool, error) {
+	if condition == nil {
+		return true, nil
+	}
+	return condition.test(item)
+}
+
+func compileConstructions(direction string, constructions []*PropertyConstructor, lookups *LookupTables) ([]*construction, error) {
+	compiled := make([]*construction, 0, len(constructions))
+	for i, c := range constructions {
+		eval, err := compileConstruction(c, lookups)
+		if err != nil {
+			return nil, fmt.Errorf("%s construction %d for property '%s': %w", direction, i, c.PropertyName, err)
+		}
+		compiled = append(compiled, &construction{property: c.PropertyName, internal: c.Internal, eval: eval})
+	}
+	return compiled, nil
+}
+
+// construction operations and their number of arguments
+var constructionArity = map[string]int{
+	"concat": 2, "split": 2, "replace": 3, "trim": 1, "tolower": 1, "toupper": 1, "regex": 2,
+	"slice": 3, "literal": 1, "strip": 1, "lookup": 2, "reverse_lookup": 2,
+}
+
+var argumentCounts = [...]string{"no arguments", "one argument", "two arguments", "three arguments"}
+
+// compileConstruction checks the arguments of the construction operation, and the table names of
+// lookups against lookups, and returns a function evaluating it
+func compileConstruction(c *PropertyConstructor, lookups *LookupTables) (func(item Item) (any, error), error) {
+	if c.Expression != "" {
+		if c.Operation != "" && c.Operation != "expression" {
+			return nil, fmt.Errorf("has both operation '%s' and an expression", c.Operation)
+		}
+		expr, err := compileExpression(c.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return expr.eval, nil
+	}
+
+	args := c.Arguments
+	n, ok := constructionArity[c.Operation]
+	if !ok {
+		return nil, fmt.Errorf("unsupported operation '%s'", c.Operation)
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("%s operation requires %s", c.Operation, argumentCounts[n])
+	}
+
+	switch c.Operation {
+	case "concat":
+		return func(item Item) (any, error) { return concat(item, args[0], args[1]) }, nil
+	case "split":
+		return func(item Item) (any, error) { return split(item, args[0], args[1]) }, nil
+	case "replace":
+		return func(item Item) (any, error) { return replace(item, args[0], args[1], args[2]) }, nil
+	case "trim":
+		return func(item Item) (any, error) { return trim(item, args[0]) }, nil
+	case "tolower":
+		return func(item Item) (any, error) { return tolower(item, args[0]) }, nil
+	case "toupper":
+		return func(item Item) (any, error) { return toupper(item, args[0]) }, nil
+	case "regex":
+		re, err := regexp.Compile(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("regex: invalid pattern: '%s': %w", args[1], err)
+		}
+		return func(item Item) (any, error) { return regex(item, args[0], re) }, nil
+	case "slice":
+		start, err := int32OfValue(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("slice: start index '%s' could not be parsed: %w", args[1], err)
+		}
+		end, err := int32OfValue(args[2])
+		if err != nil {
+			return nil, fmt.Errorf("slice: end index '%s' could not be parsed: %w", args[2], err)
+		}
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("slice: indexes %d and %d must be positive with start before end", start, end)
+		}
+		return func(item Item) (any, error) { return slice(item, args[0], start, end) }, nil
+	case "literal":
+		return func(Item) (any, error) { return args[0], nil }, nil
+	case "strip":
+		return func(item Item) (any, error) { return strip(item, args[0]) }, nil
+	default: // lookup, reverse_lookup
+		if !lookups.has(args[0]) {
+			return nil, fmt.Errorf("%s: unknown lookup table '%s'", c.Operation, args[0])
+		}
+		reverse := c.Operation == "reverse_lookup"
+		return func(item Item) (any, error) { return lookups.lookup(item, args[0], args[1], reverse) }, nil
+	}
+}
+
+// newConverter resolves the datatype and time format once and returns a converter to the
+// datatype, or nil if datatype is empty. The same conversions are used for outgoing and incoming
+// mappings.
+func newConverter(datatype string, format TimeFormat) (converter, error) {
+	switch dt := strings.ToLower(datatype); dt {
+	case "":
+		return nil, nil
+	case DatatypeDateTime, DatatypeDate, DatatypeTime, DatatypeUnix, DatatypeUnixMs:
+		return newTimeConverter(dt, format)
+	case DatatypeBigInt:
+		return func(value any) (any, error) { return bigIntOfValue(value) }, nil
+	case DatatypeUUID:
+		return func(value any) (any, error) { return uuidOfValue(value) }, nil
+	case "integer", "int":
+		return func(value any) (any, error) { return int32OfValue(value) }, nil
+	case "long":
+		return func(value any) (any, error) { return int64OfValue(value) }, nil
+	case "float":
+		return func(value any) (any, error) { return float32OfValue(value) }, nil
+	case "double":
+		return func(value any) (any, error) { return float64OfValue(value) }, nil
+	case "bool", "boolean":
+		return func(value any) (any, error) { return boolOfValue(value) }, nil
+	case "string":
+		return func(value any) (any, error) { return stringOfValue(value) }, nil
+	default:
+		decimal, ok, err := parseDecimalDatatype(dt)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unsupported datatype %s", datatype)
+		}
+		return func(value any) (any, error) { return decimalOfValue(value, decimal) }, nil
+	}
+}
@@ -0,0 +1,139 @@
+package common_datalayer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// SourcedItem is implemented by items that know where they were read from, e.g. the items of the
+// encoder iterators. The mapper uses it for the source and offset provenance properties.
+type SourcedItem interface {
+	Item
+	Source() string // source identifier, e.g. the file name
+	Offset() int    // row or record index of the item in its source, starting at 0
+}
+
+// ProvenanceConfig names the entity properties that record where an entity came from. Properties
+// without a name are not written. Names are resolved like entity_property in property mappings.
+type ProvenanceConfig struct {
+	Dataset    string `json:"dataset"`     // the dataset name
+	Source     string `json:"source"`      // source identifier of SourcedItems, e.g. the file name
+	Offset     string `json:"offset"`      // row or record index of SourcedItems
+	ConfigHash string `json:"config_hash"` // hash of the outgoing mapping config
+	Service    string `json:"service"`     // the layer service name
+	MappedAt   string `json:"mapped_at"`   // time the entity was mapped, RFC 3339 in UTC
+	// DatasetName and ServiceName are the values of the dataset and service properties. LoadConfig
+	// sets them from the dataset definition and layer config.
+	DatasetName string `json:"-"`
+	ServiceName string `json:"-"`
+}
+
+// provenancePlan is the compiled form of a ProvenanceConfig
+type provenancePlan struct {
+	*ProvenanceConfig
+	dataset    string
+	source     string
+	offset     string
+	configHash string
+	service    string
+	mappedAt   string
+	hash       string
+}
+
+func compileProvenance(config *OutgoingMappingConfig) (*provenancePlan, error) {
+	plan := &provenancePlan{ProvenanceConfig: config.Provenance}
+	properties := []struct {
+		name   string
+		target *string
+	}{
+		{plan.Dataset, &plan.dataset},
+		{plan.Source, &plan.source},
+		{plan.Offset, &plan.offset},
+		{plan.ConfigHash, &plan.configHash},
+		{plan.Service, &plan.service},
+		{plan.MappedAt, &plan.mappedAt},
+	}
+	for _, p := range properties {
+		if p.name == "" {
+			continue
+		}
+		if err := checkPrefix(p.name, config.Namespaces); err != nil {
+			return nil, fmt.Errorf("provenance: %w", err)
+		}
+		var ok bool
+		if *p.target, ok = resolveURI(p.name, config.BaseURI, config.Namespaces); !ok {
+			return nil, fmt.Errorf("base uri is required for provenance property '%s' that isnt full URI", p.name)
+		}
+	}
+	if plan.configHash != "" {
+		data, err := json.Marshal(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not hash outgoing mapping config: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		plan.hash = hex.EncodeToString(sum[:8])
+	}
+	return plan, nil
+}
+
+// apply writes the provenance properties of item to entity
+func (p *provenancePlan) apply(item Item, entity *egdm.Entity) {
+	if p.dataset != "" && p.DatasetName != "" {
+		entity.Properties[p.dataset] = p.DatasetName
+	}
+	if p.service != "" && p.ServiceName != "" {
+		entity.Properties[p.service] = p.ServiceName
+	}
+	if p.configHash != "" {
+		entity.Properties[p.configHash] = p.hash
+	}
+	if p.mappedAt != "" {
+		entity.Properties[p.mappedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if sourced, ok := item.(SourcedItem); ok {
+		if p.source != "" && sourced.Source() != "" {
+			entity.Properties[p.source] = sourced.Source()
+		}
+		if p.offset != "" {
+			entity.Properties[p.offset] = sourced.Offset()
+		}
+	}
+}
+
+// properties returns the entity properties written by the plan
+func (p *provenancePlan) properties() map[string]bool {
+	properties := make(map[string]bool)
+	for _, property := range []string{p.dataset, p.source, p.offset, p.configHash, p.service, p.mappedAt} {
+		if property != "" {
+			properties[property] = true
+		}
+	}
+	return properties
+}
+
+// provenanceProperties returns the provenance properties the mapper writes to entities, nil if none
+func (mapper *Mapper) provenanceProperties() map[string]bool {
+	if mapper.outgoing == nil || mapper.outgoing.provenance == nil {
+		return nil
+	}
+	return mapper.outgoing.provenance.properties()
+}
+
+// setProvenanceNames sets the dataset and service names of the provenance configs in config
+func setProvenanceNames(config *Config) {
+	for _, definition := range config.DatasetDefinitions {
+		if definition.OutgoingMappingConfig == nil || definition.OutgoingMappingConfig.Provenance == nil {
+			continue
+		}
+		provenance := definition.OutgoingMappingConfig.Provenance
+		provenance.DatasetName = definition.DatasetName
+		if config.LayerServiceConfig != nil {
+			provenance.ServiceName = config.LayerServiceConfig.ServiceName
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package common_datalayer
+
+import (
+	"testing"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+type sourcedItem struct {
+	MapItem
+	source string
+	offset int
+}
+
+func (s *sourcedItem) Source() string { return s.source }
+func (s *sourcedItem) Offset() int    { return s.offset }
+
+func TestMapItemToEntityWithProvenance(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	config := &Config{
+		LayerServiceConfig: &LayerServiceConfig{ServiceName: "people-layer"},
+		DatasetDefinitions: []*DatasetDefinition{{
+			DatasetName: "people",
+			OutgoingMappingConfig: &OutgoingMappingConfig{
+				BaseURI:    "http://data.example.com/schema/",
+				Namespaces: map[string]string{"prov": "http://www.w3.org/ns/prov#"},
+				Provenance: &ProvenanceConfig{
+					Dataset:    "dataset",
+					Source:     "prov:hadPrimarySource",
+					Offset:     "row",
+					ConfigHash: "mappingHash",
+					Service:    "prov:wasAttributedTo",
+					MappedAt:   "prov:generatedAtTime",
+				},
+				PropertyMappings: []*ItemToEntityPropertyMapping{
+					{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+				},
+			},
+		}},
+	}
+	setProvenanceNames(config)
+	mapper := NewMapper(logger, nil, config.DatasetDefinitions[0].OutgoingMappingConfig)
+
+	item := &sourcedItem{MapItem: MapItem{"id": "1"}, source: "people.csv", offset: 7}
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	properties := entity.Properties
+	if properties["http://data.example.com/schema/dataset"] != "people" ||
+		properties["http://www.w3.org/ns/prov#hadPrimarySource"] != "people.csv" ||
+		properties["http://data.example.com/schema/row"] != 7 ||
+		properties["http://www.w3.org/ns/prov#wasAttributedTo"] != "people-layer" {
+		t.Errorf("unexpected provenance %v", properties)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, properties["http://www.w3.org/ns/prov#generatedAtTime"].(string)); err != nil {
+		t.Errorf("expected mapping time, got %v", properties)
+	}
+	hash := properties["http://data.example.com/schema/mappingHash"]
+	if len(hash.(string)) != 16 {
+		t.Errorf("expected config hash, got %v", hash)
+	}
+
+	// items without source have no source and offset, and changing the mapping changes the hash
+	config.DatasetDefinitions[0].OutgoingMappingConfig.DefaultType = "Person"
+	entity = egdm.NewEntity()
+	if err := NewMapper(logger, nil, config.DatasetDefinitions[0].OutgoingMappingConfig).MapItemToEntity(MapItem{"id": "1"}, entity); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entity.Properties["http://data.example.com/schema/row"]; ok {
+		t.Errorf("expected no offset, got %v", entity.Properties)
+	}
+	if entity.Properties["http://data.example.com/schema/mappingHash"] == hash {
+		t.Errorf("expected config hash to change")
+	}
+}
@@ -0,0 +1,270 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitConfig limits how hard clients can use a dataset. It can be set in layer_config
+// as default for all datasets, and per dataset definition. Dataset values override the
+// layer defaults field by field. Zero values mean no limit.
+type RateLimitConfig struct {
+	MaxConcurrentRequests int     `json:"max_concurrent_requests"` // max requests served at once per dataset
+	MaxQueuedRequests     int     `json:"max_queued_requests"`     // max requests waiting for a free slot per dataset, negative for no queue
+	QueueTimeout          string  `json:"queue_timeout"`           // max time a request waits for a free slot, e.g. 30s
+	RequestsPerSecond     float64 `json:"requests_per_second"`     // token refill rate per client and dataset
+	Burst                 int     `json:"burst"`                   // token bucket size per client and dataset
+}
+
+func mergeRateLimitConfig(layerDefault *RateLimitConfig, dataset *RateLimitConfig) *RateLimitConfig {
+	merged := &RateLimitConfig{}
+	for _, c := range []*RateLimitConfig{layerDefault, dataset} {
+		if c == nil {
+			continue
+		}
+		if c.MaxConcurrentRequests != 0 {
+			merged.MaxConcurrentRequests = c.MaxConcurrentRequests
+		}
+		if c.MaxQueuedRequests != 0 {
+			merged.MaxQueuedRequests = c.MaxQueuedRequests
+		}
+		if c.QueueTimeout != "" {
+			merged.QueueTimeout = c.QueueTimeout
+		}
+		if c.RequestsPerSecond != 0 {
+			merged.RequestsPerSecond = c.RequestsPerSecond
+		}
+		if c.Burst != 0 {
+			merged.Burst = c.Burst
+		}
+	}
+	return merged
+}
+
+/******************************************************************************/
+
+type tokenBucket struct {
+	tokens   float64
+	lastFill time.Time
+}
+
+// datasetLimiter holds the concurrency slots and client token buckets of one dataset
+type datasetLimiter struct {
+	config       *RateLimitConfig
+	queueTimeout time.Duration
+	slots        chan struct{}
+	mu           sync.Mutex
+	queued       int
+	buckets      map[string]*tokenBucket
+	lastSweep    time.Time
+}
+
+func newDatasetLimiter(config *RateLimitConfig) (*datasetLimiter, error) {
+	l := &datasetLimiter{config: config, buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+	if config.MaxConcurrentRequests > 0 {
+		l.slots = make(chan struct{}, config.MaxConcurrentRequests)
+	}
+	l.queueTimeout = 30 * time.Second
+	if config.QueueTimeout != "" {
+		var err error
+		l.queueTimeout, err = asDuration(config.QueueTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// allow takes a token from the bucket of the client. If the bucket is empty it
+// returns false and the time until the next token is available.
+func (l *datasetLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	if l.config.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+	burst := float64(l.config.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(l.config.RequestsPerSecond))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now, burst)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: burst, lastFill: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.lastFill).Seconds()*l.config.RequestsPerSecond)
+	b.lastFill = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.config.RequestsPerSecond * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep removes buckets of clients that have been idle long enough to be full again
+func (l *datasetLimiter) sweep(now time.Time, burst float64) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(burst / l.config.RequestsPerSecond * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.lastFill) > refill {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// acquire waits for a free concurrency slot. It returns false if the queue is full
+// or the queue timeout expires. A MaxQueuedRequests of 0 does not limit the queue, a
+// negative one rejects requests right away when all slots are taken. Callers must call release after a successful acquire.
+func (l *datasetLimiter) acquire(c echo.Context) bool {
+	if l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	l.mu.Lock()
+	if l.config.MaxQueuedRequests < 0 || l.config.MaxQueuedRequests > 0 && l.queued >= l.config.MaxQueuedRequests {
+		l.mu.Unlock()
+		return false
+	}
+	l.queued++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-c.Request().Context().Done():
+		return false
+	}
+}
+
+func (l *datasetLimiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+/******************************************************************************/
+
+// rateLimiter enforces RateLimitConfig for the dataset routes of the web service. Limiters are
+// only created for datasets that exist, and are rebuilt from the new config on config updates.
+type rateLimiter struct {
+	config   *Config
+	exists   func(dataset string) bool
+	logger   Logger
+	metrics  Metrics
+	mu       sync.Mutex
+	datasets map[string]*datasetLimiter
+}
+
+func newRateLimiter(config *Config, exists func(dataset string) bool, logger Logger, metrics Metrics) *rateLimiter {
+	return &rateLimiter{config: config, exists: exists, logger: logger, metrics: metrics, datasets: make(map[string]*datasetLimiter)}
+}
+
+// update replaces the config and drops the limiters of the old config. Requests holding a slot of
+// an old limiter release it there.
+func (r *rateLimiter) update(config *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = config
+	r.datasets = make(map[string]*datasetLimiter)
+}
+
+// limiterFor returns the limiter of dataset, or nil if the dataset does not exist
+func (r *rateLimiter) limiterFor(dataset string) (*datasetLimiter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.datasets[dataset]; ok {
+		return l, nil
+	}
+	if !r.exists(dataset) {
+		return nil, nil
+	}
+	var datasetConfig *RateLimitConfig
+	if def := r.config.GetDatasetDefinition(dataset); def != nil {
+		datasetConfig = def.RateLimit
+	}
+	l, err := newDatasetLimiter(mergeRateLimitConfig(r.config.LayerServiceConfig.RateLimit, datasetConfig))
+	if err != nil {
+		return nil, err
+	}
+	r.datasets[dataset] = l
+	return l, nil
+}
+
+func (r *rateLimiter) throttled(c echo.Context, dataset string, reason string, status int, retryAfter time.Duration) error {
+	tags := []string{"dataset:" + dataset, "reason:" + reason}
+	if err := r.metrics.Incr("http.throttled", tags, 1); err != nil {
+		r.logger.Warn("Error with metrics", "error", err.Error())
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	r.logger.Warn("Request throttled", "dataset", dataset, "reason", reason)
+	return echo.NewHTTPError(status, fmt.Sprintf("too many requests for dataset %s (%s)", dataset, reason))
+}
+
+// middleware limits requests to routes with a :dataset parameter
+func (r *rateLimiter) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		dataset, _ := url.QueryUnescape(c.Param("dataset"))
+		l, err := r.limiterFor(dataset)
+		if err != nil {
+			r.logger.Error("Invalid rate limit configuration", "dataset", dataset, "error", err.Error())
+			return echo.NewHTTPError(http.StatusInternalServerError, "invalid rate limit configuration")
+		}
+		if l == nil {
+			// the handler responds that the dataset does not exist
+			return next(c)
+		}
+
+		client := clientKey(c)
+		if ok, wait := l.allow(client, time.Now()); !ok {
+			return r.throttled(c, dataset, "rate_limit", http.StatusTooManyRequests, wait)
+		}
+
+		if !l.acquire(c) {
+			return r.throttled(c, dataset, "concurrency", http.StatusServiceUnavailable, time.Second)
+		}
+		defer l.release()
+		return next(c)
+	}
+}
+
+// clientKey identifies the client of a request. Clients with a verified certificate are keyed by
+// its name, other clients by their remote address. Forwarding headers like X-Forwarded-For can be
+// set by anyone, so they are only used if the echo server has an IPExtractor for its proxies.
+func clientKey(c echo.Context) string {
+	if identity := ClientIdentityFromContext(c.Request().Context()); identity != nil && identity.Certificate != nil {
+		return identity.Name
+	}
+	return remoteAddress(c)
+}
@@ -0,0 +1,193 @@
+package common_datalayer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMergeRateLimitConfig(t *testing.T) {
+	merged := mergeRateLimitConfig(
+		&RateLimitConfig{MaxConcurrentRequests: 4, RequestsPerSecond: 10, QueueTimeout: "10s"},
+		&RateLimitConfig{MaxConcurrentRequests: 1, Burst: 2},
+	)
+	if merged.MaxConcurrentRequests != 1 {
+		t.Error("dataset max_concurrent_requests should override layer default")
+	}
+	if merged.RequestsPerSecond != 10 || merged.QueueTimeout != "10s" {
+		t.Error("layer defaults should be kept when not set on dataset")
+	}
+	if merged.Burst != 2 {
+		t.Error("burst should be taken from dataset")
+	}
+}
+
+func TestTokenBucketPerClient(t *testing.T) {
+	l, err := newDatasetLimiter(&RateLimitConfig{RequestsPerSecond: 1, Burst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Errorf("request %d should be allowed within burst", i)
+		}
+	}
+	ok, wait := l.allow("a", now)
+	if ok {
+		t.Error("third request should be throttled")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("unexpected retry wait %v", wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("other clients should have their own bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(time.Second)); !ok {
+		t.Error("bucket should refill over time")
+	}
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	e := echo.New()
+	context := func() echo.Context {
+		return e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	}
+	for _, test := range []struct {
+		maxQueued int
+		queued    bool
+	}{{maxQueued: 0, queued: true}, {maxQueued: 1, queued: true}, {maxQueued: -1, queued: false}} {
+		l, err := newDatasetLimiter(&RateLimitConfig{MaxConcurrentRequests: 1, MaxQueuedRequests: test.maxQueued, QueueTimeout: "5s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !l.acquire(context()) {
+			t.Fatalf("max_queued_requests %d: first request should get a slot", test.maxQueued)
+		}
+		if !test.queued {
+			if l.acquire(context()) {
+				t.Errorf("max_queued_requests %d: request should be rejected without queue", test.maxQueued)
+			}
+			l.release()
+			continue
+		}
+		acquired := make(chan bool)
+		go func() { acquired <- l.acquire(context()) }()
+		// wait until the second request is queued
+		for i := 0; i < 100; i++ {
+			l.mu.Lock()
+			queued := l.queued
+			l.mu.Unlock()
+			if queued == 1 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if test.maxQueued == 1 && l.acquire(context()) {
+			t.Errorf("max_queued_requests 1: request should be rejected when the queue is full")
+		}
+		l.release()
+		if !<-acquired {
+			t.Errorf("max_queued_requests %d: queued request should get the released slot", test.maxQueued)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	metrics, _ := newMetrics(&Config{LayerServiceConfig: &LayerServiceConfig{}})
+	config := &Config{
+		LayerServiceConfig: &LayerServiceConfig{},
+		DatasetDefinitions: []*DatasetDefinition{{
+			DatasetName: "people",
+			RateLimit:   &RateLimitConfig{MaxConcurrentRequests: 1, MaxQueuedRequests: -1},
+		}, {
+			DatasetName: "places",
+			RateLimit:   &RateLimitConfig{RequestsPerSecond: 0.001, Burst: 1},
+		}},
+	}
+	limiter := newRateLimiter(config, func(dataset string) bool {
+		return config.GetDatasetDefinition(dataset) != nil
+	}, logger, metrics)
+
+	e := echo.New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	e.GET("/datasets/:dataset/changes", func(c echo.Context) error {
+		if c.Param("dataset") == "people" {
+			started <- struct{}{}
+			<-release
+		}
+		return c.NoContent(http.StatusOK)
+	}, limiter.middleware)
+
+	// concurrency limit with no queue rejects the second request
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets/people/changes", nil))
+	}()
+	<-started
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets/people/changes", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	close(release)
+	wg.Wait()
+
+	// rate limit
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets/places/changes", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets/places/changes", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	// clients are keyed by remote address, not by forwarding headers
+	req := httptest.NewRequest(http.MethodGet, "/datasets/places/changes", nil)
+	req.Header.Set("X-Forwarded-For", "10.1.2.3")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for spoofed client address, got %d", rec.Code)
+	}
+
+	// unknown datasets get no limiter
+	for i := 0; i < 3; i++ {
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets/unknown"+strconv.Itoa(i)+"/changes", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rec.Code)
+		}
+	}
+	if len(limiter.datasets) != 2 {
+		t.Errorf("expected limiters for 2 datasets, got %d", len(limiter.datasets))
+	}
+
+	// config updates replace the limiters
+	updated := &Config{LayerServiceConfig: &LayerServiceConfig{}, DatasetDefinitions: []*DatasetDefinition{{DatasetName: "places"}}}
+	limiter.update(updated)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets/places/changes", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 after config update, got %d", rec.Code)
+	}
+}
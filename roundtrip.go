@@ -0,0 +1,199 @@
+package common_datalayer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// kinds of round trip issues
+const (
+	RoundTripLost         = "lost"          // the property is missing after the round trip
+	RoundTripRenamed      = "renamed"       // the value came back under another property name
+	RoundTripTypeChanged  = "type_changed"  // the value came back with another type, e.g. "39" as int 39
+	RoundTripValueChanged = "value_changed" // the value came back different
+	RoundTripAdded        = "added"         // the property was not on the original item
+)
+
+// RoundTripIssue is a difference between items and the result of mapping them to entities and
+// back, aggregated over all items with the same kind of difference for the same property
+type RoundTripIssue struct {
+	Kind      string `json:"kind"`
+	Property  string `json:"property"`
+	RenamedTo string `json:"renamed_to,omitempty"`
+	Count     int    `json:"count"`    // number of items with the issue
+	Original  any    `json:"original"` // values of the first item with the issue
+	Returned  any    `json:"returned"`
+}
+
+// RoundTripReport is the result of VerifyRoundTrip
+type RoundTripReport struct {
+	Dataset  string            `json:"dataset"`
+	Items    int               `json:"items"`
+	Filtered int               `json:"filtered"` // items rejected by the outgoing or incoming filter
+	Errors   []string          `json:"errors"`   // items that could not be mapped
+	Issues   []*RoundTripIssue `json:"issues"`
+}
+
+// OK returns true if all items were mapped back without errors or differences
+func (r *RoundTripReport) OK() bool {
+	return len(r.Errors) == 0 && len(r.Issues) == 0
+}
+
+// Write prints the report in a human readable form
+func (r *RoundTripReport) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "dataset %s: %d items, %d filtered, %d errors, %d issues\n", r.Dataset, r.Items, r.Filtered, len(r.Errors), len(r.Issues))
+	if err != nil {
+		return err
+	}
+	for _, e := range r.Errors {
+		if _, err = fmt.Fprintf(w, "  error: %s\n", e); err != nil {
+			return err
+		}
+	}
+	for _, issue := range r.Issues {
+		switch issue.Kind {
+		case RoundTripRenamed:
+			_, err = fmt.Fprintf(w, "  %s: %s -> %s (%d items)\n", issue.Kind, issue.Property, issue.RenamedTo, issue.Count)
+		case RoundTripLost:
+			_, err = fmt.Fprintf(w, "  %s: %s (%d items), e.g. %v\n", issue.Kind, issue.Property, issue.Count, issue.Original)
+		case RoundTripAdded:
+			_, err = fmt.Fprintf(w, "  %s: %s (%d items), e.g. %v\n", issue.Kind, issue.Property, issue.Count, issue.Returned)
+		default:
+			_, err = fmt.Fprintf(w, "  %s: %s (%d items), e.g. %v (%T) -> %v (%T)\n", issue.Kind, issue.Property, issue.Count,
+				issue.Original, issue.Original, issue.Returned, issue.Returned)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyRoundTrip maps each item to an entity with the outgoing mapping config of the dataset, then
+// the entity back to a new item from newItem with the incoming mapping config, and reports the
+// properties that are lost, renamed or changed on the way. Items from a file can be read with the
+// encoder package, e.g. encoder.NewItemIterator and the NewItem method of encoder.NewItemFactory.
+// At most maxItems items are read, all items if maxItems is 0. lookups are the lookup tables of the
+// config, nil if the mappings have no lookup constructions.
+func VerifyRoundTrip(logger Logger, lookups *LookupTables, definition *DatasetDefinition, items ItemIterator, newItem func() Item, maxItems int) (*RoundTripReport, error) {
+	if definition.OutgoingMappingConfig == nil || definition.IncomingMappingConfig == nil {
+		return nil, fmt.Errorf("dataset %s needs both an outgoing and an incoming mapping config", definition.DatasetName)
+	}
+	mapper := NewMapperWithLookups(logger, lookups, definition.IncomingMappingConfig, definition.OutgoingMappingConfig)
+	if err := mapper.Err(); err != nil {
+		return nil, fmt.Errorf("invalid mapping config for dataset %s: %w", definition.DatasetName, err)
+	}
+
+	report := &RoundTripReport{Dataset: definition.DatasetName, Errors: make([]string, 0), Issues: make([]*RoundTripIssue, 0)}
+	type issueKey struct{ kind, property, renamedTo string }
+	issues := make(map[issueKey]*RoundTripIssue)
+	for maxItems <= 0 || report.Items < maxItems {
+		item, err := items.Read()
+		if err != nil {
+			return nil, fmt.Errorf("could not read item: %w", err)
+		}
+		if item == nil {
+			break
+		}
+		report.Items++
+
+		entity := egdm.NewEntity()
+		err = mapper.MapItemToEntity(item, entity)
+		if err == nil {
+			returned := newItem()
+			if err = mapper.MapEntityToItem(entity, returned); err == nil {
+				for _, issue := range compareItems(item, returned) {
+					key := issueKey{issue.Kind, issue.Property, issue.RenamedTo}
+					if existing, ok := issues[key]; ok {
+						existing.Count++
+						continue
+					}
+					issues[key] = issue
+					report.Issues = append(report.Issues, issue)
+				}
+				continue
+			}
+		}
+		if errors.Is(err, ErrItemFiltered) {
+			report.Filtered++
+			continue
+		}
+		report.Errors = append(report.Errors, fmt.Sprintf("item %d: %s", report.Items, err.Error()))
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		if report.Issues[i].Property != report.Issues[j].Property {
+			return report.Issues[i].Property < report.Issues[j].Property
+		}
+		return report.Issues[i].Kind < report.Issues[j].Kind
+	})
+	return report, nil
+}
+
+// compareItems returns the differences between an item and the result of its round trip
+func compareItems(original Item, returned Item) []*RoundTripIssue {
+	returnedNames := make(map[string]bool)
+	for _, name := range returned.GetPropertyNames() {
+		returnedNames[name] = true
+	}
+	originalNames := make(map[string]bool)
+	for _, name := range original.GetPropertyNames() {
+		originalNames[name] = true
+	}
+	// names only on the returned item are candidates for renamed properties
+	added := make([]string, 0)
+	for name := range returnedNames {
+		if !originalNames[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	names := original.GetPropertyNames()
+	sort.Strings(names)
+
+	issues := make([]*RoundTripIssue, 0)
+	renamed := make(map[string]bool)
+	for _, name := range names {
+		value := original.GetValue(name)
+		if !returnedNames[name] {
+			if value == nil {
+				continue
+			}
+			issue := &RoundTripIssue{Kind: RoundTripLost, Property: name, Count: 1, Original: value}
+			for _, candidate := range added {
+				if !renamed[candidate] && sameValue(value, returned.GetValue(candidate)) {
+					renamed[candidate] = true
+					issue = &RoundTripIssue{Kind: RoundTripRenamed, Property: name, RenamedTo: candidate, Count: 1, Original: value, Returned: returned.GetValue(candidate)}
+					break
+				}
+			}
+			issues = append(issues, issue)
+			continue
+		}
+		returnedValue := returned.GetValue(name)
+		if reflect.DeepEqual(value, returnedValue) {
+			continue
+		}
+		kind := RoundTripValueChanged
+		if sameValue(value, returnedValue) {
+			kind = RoundTripTypeChanged
+		}
+		issues = append(issues, &RoundTripIssue{Kind: kind, Property: name, Count: 1, Original: value, Returned: returnedValue})
+	}
+	for _, name := range added {
+		if !renamed[name] && returned.GetValue(name) != nil {
+			issues = append(issues, &RoundTripIssue{Kind: RoundTripAdded, Property: name, Count: 1, Returned: returned.GetValue(name)})
+		}
+	}
+	return issues
+}
+
+// sameValue returns true if a and b are equal or have the same string representation
+func sameValue(a any, b any) bool {
+	return reflect.DeepEqual(a, b) || fmt.Sprint(a) == fmt.Sprint(b)
+}
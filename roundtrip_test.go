@@ -0,0 +1,80 @@
+package common_datalayer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRoundTrip(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	definition := &DatasetDefinition{
+		DatasetName: "people",
+		OutgoingMappingConfig: &OutgoingMappingConfig{
+			BaseURI: "http://data.example.com/schema/",
+			Filter:  "status != 'archived'",
+			PropertyMappings: []*ItemToEntityPropertyMapping{
+				{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+				{Property: "age", EntityProperty: "age", Datatype: "int"},
+				{Property: "status", EntityProperty: "status"},
+				{Property: "nick", EntityProperty: "nickname"},
+			},
+		},
+		IncomingMappingConfig: &IncomingMappingConfig{
+			BaseURI: "http://data.example.com/schema/",
+			PropertyMappings: []*EntityToItemPropertyMapping{
+				{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+				{Property: "age", EntityProperty: "age", Datatype: "string"},
+				{Property: "status", EntityProperty: "status"},
+				{Property: "alias", EntityProperty: "nickname"},
+				{Property: "source", EntityProperty: "source", DefaultValue: "import"},
+			},
+		},
+	}
+	newItem := func() Item { return MapItem{} }
+	person := func(id string, age int, status string) Item {
+		return MapItem{"id": id, "age": age, "status": status, "nick": "p" + id, "email": id + "@example.com"}
+	}
+	broken := newItem()
+	broken.SetValue("status", "active")
+	items := &sliceItemIterator{items: []Item{
+		person("1", 39, "active"),
+		person("2", 50, "archived"),
+		person("3", 10, "active"),
+		broken,
+	}}
+
+	report, err := VerifyRoundTrip(logger, nil, definition, items, newItem, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Items != 4 || report.Filtered != 1 || len(report.Errors) != 1 || report.OK() {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	expected := map[string]string{
+		"age":    RoundTripTypeChanged,
+		"email":  RoundTripLost,
+		"nick":   RoundTripRenamed,
+		"source": RoundTripAdded,
+	}
+	if len(report.Issues) != len(expected) {
+		t.Errorf("expected %d issues, got %d", len(expected), len(report.Issues))
+	}
+	for _, issue := range report.Issues {
+		if expected[issue.Property] != issue.Kind || issue.Count != 2 {
+			t.Errorf("unexpected issue %+v", issue)
+		}
+		if issue.Kind == RoundTripRenamed && issue.RenamedTo != "alias" {
+			t.Errorf("expected nick to be renamed to alias, got %s", issue.RenamedTo)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := report.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "renamed: nick -> alias (2 items)") {
+		t.Errorf("unexpected output %s", out.String())
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/hashicorp/go-uuid"
 	layer "github.com/mimiro-io/common-datalayer"
@@ -140,6 +141,9 @@ type FileSystemDatasetWriter struct {
 func (f FileSystemDatasetWriter) Write(entity *egdm.Entity) layer.LayerError {
 	item := f.factory.NewItem()
 	err := f.mapper.MapEntityToItem(entity, item)
+	if errors.Is(err, layer.ErrItemFiltered) {
+		return nil
+	}
 	if err != nil {
 		return layer.Err(fmt.Errorf("could not map entity to item because %s", err.Error()), layer.LayerErrorInternal)
 	}
@@ -254,14 +258,41 @@ type FileCollectionEntityIterator struct {
 	currentItemReader encoder.ItemIterator
 	sourceConfig      map[string]any
 	logger            layer.Logger
+	pending           []*egdm.Entity // entities linked to the last item by inverse references
 }
 
 func (f *FileCollectionEntityIterator) Context() *egdm.Context {
-	ctx := egdm.NewNamespaceContext()
-	return ctx.AsContext()
+	return f.mapper.Context()
 }
 
 func (f *FileCollectionEntityIterator) Next() (*egdm.Entity, layer.LayerError) {
+	if len(f.pending) > 0 {
+		entity := f.pending[0]
+		f.pending = f.pending[1:]
+		return entity, nil
+	}
+	for {
+		item, err := f.readItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return nil, nil
+		}
+		entities, mapErr := f.mapper.MapItemToEntities(item)
+		if errors.Is(mapErr, layer.ErrItemFiltered) {
+			continue
+		}
+		if mapErr != nil {
+			return nil, layer.Err(fmt.Errorf("could not map item to entity because %s", mapErr.Error()), layer.LayerErrorInternal)
+		}
+		f.pending = entities[1:]
+		return entities[0], nil
+	}
+}
+
+// readItem reads the next item, moving on to the next file when the current one is exhausted
+func (f *FileCollectionEntityIterator) readItem() (layer.Item, layer.LayerError) {
 	if f.currentItemReader == nil {
 		if f.filesIndex < len(f.files) {
 			// initialize the current file entity iterator
@@ -303,16 +334,7 @@ func (f *FileCollectionEntityIterator) Next() (*egdm.Entity, layer.LayerError) {
 		}
 	}
 
-	if item == nil {
-		return nil, nil
-	} else {
-		entity := &egdm.Entity{Properties: make(map[string]any)}
-		err := f.mapper.MapItemToEntity(item, entity)
-		if err != nil {
-			return nil, layer.Err(fmt.Errorf("could not map item to entity because %s", err.Error()), layer.LayerErrorInternal)
-		}
-		return entity, nil
-	}
+	return item, nil
 }
 
 func (f *FileCollectionEntityIterator) NewItemReadCloser(filePath string, sourceConfig map[string]any) (encoder.ItemIterator, error) {
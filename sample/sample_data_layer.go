@@ -60,7 +60,10 @@ func NewSampleDataLayer(conf *layer.Config, logger layer.Logger, metrics layer.M
 
 	// iterate over the dataset definitions in the configuration
 	for _, dsd := range conf.DatasetDefinitions {
-		mapper := layer.NewMapper(logger, dsd.IncomingMappingConfig, dsd.OutgoingMappingConfig)
+		mapper := layer.NewMapperWithLookups(logger, conf.LookupTables(), dsd.IncomingMappingConfig, dsd.OutgoingMappingConfig)
+		if err := mapper.Err(); err != nil {
+			return nil, fmt.Errorf("invalid mapping config for dataset %s: %w", dsd.DatasetName, err)
+		}
 		sampleDataLayer.datasets[dsd.DatasetName] = &SampleDataset{dsName: dsd.DatasetName, mapper: mapper}
 	}
 
@@ -90,7 +93,10 @@ func (dl *SampleDataLayer) UpdateConfiguration(config *layer.Config) layer.Layer
 	for k, v := range dl.datasets {
 		for _, dsd := range config.DatasetDefinitions {
 			if k == dsd.DatasetName {
-				mapper := layer.NewMapper(dl.logger, dsd.IncomingMappingConfig, dsd.OutgoingMappingConfig)
+				mapper := layer.NewMapperWithLookups(dl.logger, config.LookupTables(), dsd.IncomingMappingConfig, dsd.OutgoingMappingConfig)
+				if err := mapper.Err(); err != nil {
+					return layer.Err(fmt.Errorf("invalid mapping config for dataset %s: %w", dsd.DatasetName, err), layer.LayerErrorBadParameter)
+				}
 				v.mapper = mapper
 			}
 		}
@@ -100,7 +106,9 @@ func (dl *SampleDataLayer) UpdateConfiguration(config *layer.Config) layer.Layer
 
 /*********************************************************************************************************************/
 
-// SampleDataset is a sample implementation of the Dataset interface, it provides a simple in-memory dataset in this case
+// SampleDataset is a sample implementation of the Dataset interface, it provides a simple in-memory dataset in this case.
+// It supports reading changes and entities, and incremental writes. Full sync is not supported, so it does
+// not implement layer.FullSyncDataset.
 type SampleDataset struct {
 	dsName string
 	mapper *layer.Mapper
@@ -123,10 +131,6 @@ func (ds *SampleDataset) MetaData() map[string]any {
 	return nil
 }
 
-func (ds *SampleDataset) FullSync(_ context.Context, _ layer.BatchInfo) (layer.DatasetWriter, layer.LayerError) {
-	return nil, layer.Err(errors.New("full sync not implemented"), layer.LayerNotSupported)
-}
-
 func (ds *SampleDataset) Incremental(ctx context.Context) (layer.DatasetWriter, layer.LayerError) {
 	return NewSampleDatasetWriter(ds, ds.mapper, ctx, layer.BatchInfo{}), nil
 }
@@ -143,6 +147,9 @@ func (sei *SampleEntityIterator) Next() (*egdm.Entity, layer.LayerError) {
 		sei.index++
 		entity := &egdm.Entity{Properties: make(map[string]any)}
 		err := sei.mapper.MapItemToEntity(dataObject, entity)
+		if errors.Is(err, layer.ErrItemFiltered) {
+			continue
+		}
 		if err != nil {
 			return nil, layer.Errorf(layer.LayerErrorInternal, "error mapping data object %s", dataObject.ID)
 		}
@@ -152,7 +159,7 @@ func (sei *SampleEntityIterator) Next() (*egdm.Entity, layer.LayerError) {
 }
 
 func (sei *SampleEntityIterator) Context() *egdm.Context {
-	return nil
+	return sei.mapper.Context()
 }
 
 func (sei *SampleEntityIterator) Token() (*egdm.Continuation, layer.LayerError) {
@@ -182,6 +189,9 @@ func (sdw *SampleDatasetWriter) Write(entity *egdm.Entity) layer.LayerError {
 	// convert to DataObject
 	dataObject := &DataObject{ID: entity.ID, Props: map[string]any{}}
 	err := sdw.mapper.MapEntityToItem(entity, dataObject)
+	if errors.Is(err, layer.ErrItemFiltered) {
+		return nil
+	}
 	if err != nil {
 		return layer.Err(err, layer.LayerErrorInternal)
 	}
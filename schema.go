@@ -0,0 +1,74 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SchemaField is a property of an item schema. Type is one of the datatypes of the property
+// mappings, e.g. string, long or datetime, or empty if the source does not type its values.
+type SchemaField struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// Schema is the ordered list of properties of the items of a source, e.g. the columns of a csv
+// file or the fields of a parquet schema
+type Schema []SchemaField
+
+// Names returns the property names in schema order
+func (s Schema) Names() []string {
+	names := make([]string, len(s))
+	for i, field := range s {
+		names[i] = field.Name
+	}
+	return names
+}
+
+// SchemaItem is implemented by items that know the schema of their source, like the items of the
+// csv, parquet and flat file encoders. Their GetPropertyNames returns the names in schema order.
+// The mapper uses the schema for the properties and datatypes of map_named.
+type SchemaItem interface {
+	Item
+	Schema() Schema
+}
+
+// schemaOf returns the schema of item, or nil if it has none
+func schemaOf(item Item) Schema {
+	if schemaItem, ok := item.(SchemaItem); ok {
+		return schemaItem.Schema()
+	}
+	return nil
+}
+
+var schemaConverters sync.Map // datatype -> converter
+
+// schemaConverter returns the converter for the type of a schema field, nil if it has no type
+func schemaConverter(field SchemaField) (converter, error) {
+	if field.Type == "" {
+		return nil, nil
+	}
+	if convert, ok := schemaConverters.Load(field.Type); ok {
+		return convert.(converter), nil
+	}
+	convert, err := newConverter(field.Type, TimeFormat{})
+	if err != nil {
+		return nil, fmt.Errorf("schema field %s: %w", field.Name, err)
+	}
+	schemaConverters.Store(field.Type, convert)
+	return convert, nil
+}
+
+// convertSchemaValue converts value, or each element of a list value into a new list
+func convertSchemaValue(convert converter, value any) (any, error) {
+	values, ok := asList(value)
+	if !ok {
+		return convert(value)
+	}
+	converted := make([]any, len(values))
+	copy(converted, values)
+	if err := convertValues(convert, converted); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
@@ -0,0 +1,62 @@
+package common_datalayer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+type schemaItem struct {
+	MapItem
+	schema Schema
+}
+
+func (s *schemaItem) Schema() Schema { return s.schema }
+
+func TestMapWithSchema(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	schema := Schema{{Name: "name", Type: "string"}, {Name: "age", Type: "int"}, {Name: "born", Type: "datetime"}, {Name: "scores", Type: "double"}, {Name: "id"}}
+
+	incomingConfig := &IncomingMappingConfig{BaseURI: "http://data.example.com/schema/", MapNamed: true}
+	entity := egdm.NewEntity().SetID("http://data.example.com/people/1")
+	entity.Properties["http://data.example.com/schema/name"] = "Homer"
+	entity.Properties["http://data.example.com/schema/age"] = "39"
+	entity.Properties["http://data.example.com/schema/born"] = "1956-05-12"
+	scores := []any{"1.5", 2}
+	entity.Properties["http://data.example.com/schema/scores"] = scores
+	entity.Properties["http://data.example.com/schema/unknown"] = "x"
+	item := &schemaItem{MapItem: MapItem{}, schema: schema}
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, item); err != nil {
+		t.Fatal(err)
+	}
+	expected := MapItem{"name": "Homer", "age": 39, "born": time.Date(1956, 5, 12, 0, 0, 0, 0, time.UTC), "scores": []any{1.5, 2.0}}
+	if !reflect.DeepEqual(item.MapItem, expected) {
+		t.Errorf("expected %v, got %v", expected, item.MapItem)
+	}
+	if scores[0] != "1.5" {
+		t.Errorf("expected entity values to be unchanged")
+	}
+
+	entity.Properties["http://data.example.com/schema/age"] = "old"
+	if err := NewMapper(logger, incomingConfig, nil).MapEntityToItem(entity, &schemaItem{MapItem: MapItem{}, schema: schema}); err == nil {
+		t.Errorf("expected conversion to int to fail")
+	}
+
+	// map_all maps the properties of the item, not those of the schema, and leaves out nil values
+	item = &schemaItem{MapItem: MapItem{"id": "1", "name": "Homer", "nickname": "Homie", "age": nil}, schema: schema}
+	outgoingConfig := &OutgoingMappingConfig{BaseURI: "http://data.example.com/schema/", MapAll: true}
+	entity = egdm.NewEntity()
+	if err := NewMapper(logger, nil, outgoingConfig).MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	expectedProperties := map[string]any{
+		"http://data.example.com/schema/id":       "1",
+		"http://data.example.com/schema/name":     "Homer",
+		"http://data.example.com/schema/nickname": "Homie",
+	}
+	if !reflect.DeepEqual(entity.Properties, expectedProperties) {
+		t.Errorf("expected %v, got %v", expectedProperties, entity.Properties)
+	}
+}
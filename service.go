@@ -58,6 +58,12 @@ func (serviceRunner *ServiceRunner) configure() {
 		}
 	}
 
+	err = LoadLookupTables(config)
+	if err != nil {
+		serviceRunner.logger.Error("Failed to load lookup tables", "error", err.Error())
+		panic(err)
+	}
+
 	// initialise logger
 	logger := NewLogger(
 		config.LayerServiceConfig.ServiceName,
@@ -81,14 +87,6 @@ func (serviceRunner *ServiceRunner) configure() {
 	}
 	serviceRunner.logger.Info("Data layer service created")
 
-	// create and start config updater
-	serviceRunner.configUpdater, err = newConfigUpdater(config, serviceRunner.enrichConfig, logger, serviceRunner.layerService)
-	if err != nil {
-		serviceRunner.logger.Error("Failed to start config updater", "error", err.Error())
-		panic(err)
-	}
-	serviceRunner.logger.Info("Config updater started")
-
 	// create web service hook up with the service core
 	serviceRunner.webService, err = newDataLayerWebService(config, logger, metrics, serviceRunner.layerService)
 	if err != nil {
@@ -97,6 +95,15 @@ func (serviceRunner *ServiceRunner) configure() {
 	}
 	serviceRunner.logger.Info("Web service created")
 
+	// create and start config updater
+	serviceRunner.configUpdater, err = newConfigUpdater(config, serviceRunner.enrichConfig, logger,
+		serviceRunner.layerService, serviceRunner.webService)
+	if err != nil {
+		serviceRunner.logger.Error("Failed to start config updater", "error", err.Error())
+		panic(err)
+	}
+	serviceRunner.logger.Info("Config updater started")
+
 	serviceRunner.stoppable = append(
 		serviceRunner.stoppable,
 		serviceRunner.layerService,
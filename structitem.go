@@ -0,0 +1,281 @@
+package common_datalayer
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StructItem is an Item backed by a Go struct, so layers with typed rows do not need to write an
+// Item by hand. The properties are the exported fields, named by their cdl tag, e.g.
+// `cdl:"name"`, or else by the field name. Fields tagged `cdl:"-"` are left out, and the fields of
+// embedded structs are properties of the item.
+//
+// GetValue returns nested structs as nested objects, map[string]any, and slices as lists, []any,
+// so that property paths like $.address.city work on them. Values that marshal themselves to
+// text, like time.Time and *big.Int, are returned as they are. SetValue converts values to the
+// type of the field, including nested objects to structs and lists to slices. As Item has no
+// error results, values that cannot be set are reported by Err.
+type StructItem struct {
+	value  reflect.Value // the struct
+	fields *structFields
+	err    error
+}
+
+type structFields struct {
+	names []string
+	index map[string][]int
+}
+
+var (
+	structFieldsCache sync.Map // reflect.Type -> *structFields
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// NewStructItem returns an Item for the struct ptr points to, changes by SetValue are made to it
+func NewStructItem(ptr any) (*StructItem, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struct item requires a pointer to a struct, got %T", ptr)
+	}
+	return &StructItem{value: v.Elem(), fields: fieldsOf(v.Elem().Type())}, nil
+}
+
+func fieldsOf(t reflect.Type) *structFields {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.(*structFields)
+	}
+	fields := &structFields{index: make(map[string][]int)}
+	collectFields(t, nil, fields)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, parent []int, fields *structFields) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("cdl"), ",")
+		if name == "-" || !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+		// embedded structs without tag add their fields, embedded pointers are not followed as
+		// they may be nil
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			collectFields(field.Type, index, fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := fields.index[name]; ok {
+			continue // the outermost field wins
+		}
+		fields.names = append(fields.names, name)
+		fields.index[name] = index
+	}
+}
+
+// Err returns the first error of SetValue, or nil if all values were set
+func (s *StructItem) Err() error {
+	return s.err
+}
+
+func (s *StructItem) GetValue(name string) any {
+	index, ok := s.fields.index[name]
+	if !ok {
+		return nil
+	}
+	return itemValueOf(s.value.FieldByIndex(index))
+}
+
+func (s *StructItem) SetValue(name string, value any) {
+	if err := s.Set(name, value); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Set is SetValue with an error if the struct has no field for name or the value cannot be
+// converted to its type
+func (s *StructItem) Set(name string, value any) error {
+	index, ok := s.fields.index[name]
+	if !ok {
+		return fmt.Errorf("%s has no property %s", s.value.Type(), name)
+	}
+	field := s.value.FieldByIndex(index)
+	if err := assignValue(field, value); err != nil {
+		return &ConversionError{Property: name, Value: value, Type: field.Type().String(), Err: err}
+	}
+	return nil
+}
+
+// NativeItem returns the pointer to the struct
+func (s *StructItem) NativeItem() any {
+	return s.value.Addr().Interface()
+}
+
+// GetPropertyNames returns the property names in field order
+func (s *StructItem) GetPropertyNames() []string {
+	// the names are shared by all items of the struct type, callers may sort or append to the result
+	return slices.Clone(s.fields.names)
+}
+
+// itemValueOf returns the item value of a field
+func itemValueOf(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Pointer && v.Type().Implements(textMarshalerType) {
+			return v.Interface()
+		}
+		return itemValueOf(v.Elem())
+	case reflect.Struct:
+		if v.Type() == timeType || reflect.PointerTo(v.Type()).Implements(textMarshalerType) {
+			return v.Interface()
+		}
+		fields := fieldsOf(v.Type())
+		object := make(map[string]any, len(fields.names))
+		for _, name := range fields.names {
+			object[name] = itemValueOf(v.FieldByIndex(fields.index[name]))
+		}
+		return object
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = itemValueOf(v.Index(i))
+		}
+		return list
+	}
+	return v.Interface()
+}
+
+// assignValue sets v to value converted to the type of v
+func assignValue(v reflect.Value, value any) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(v.Type()) {
+		v.Set(src)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := assignValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		s, err := stringOfValue(value)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			if s, ok := value.(string); ok {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					return err
+				}
+				v.SetInt(int64(d))
+				return nil
+			}
+		}
+		i, err := int64OfValue(value)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return errors.New("value out of range")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := int64OfValue(value)
+		if err != nil {
+			return err
+		}
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return errors.New("value out of range")
+		}
+		v.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, err := float64OfValue(value)
+		if err != nil {
+			return err
+		}
+		if v.OverflowFloat(f) {
+			return errors.New("value out of range")
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := boolOfValue(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Struct:
+		if v.Type() == timeType {
+			t, err := timeOfValue(value, "", time.UTC, 0)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return errors.New("nested structs require nested objects")
+		}
+		fields := fieldsOf(v.Type())
+		for name, fieldValue := range object {
+			index, ok := fields.index[name]
+			if !ok {
+				return fmt.Errorf("%s has no property %s", v.Type(), name)
+			}
+			if err := assignValue(v.FieldByIndex(index), fieldValue); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	case reflect.Slice:
+		list, ok := asList(value)
+		if !ok {
+			list = []any{value}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, element := range list {
+			if err := assignValue(slice.Index(i), element); err != nil {
+				return fmt.Errorf("list element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	default:
+		if !src.Type().ConvertibleTo(v.Type()) {
+			return errors.New("unsupported type")
+		}
+		v.Set(src.Convert(v.Type()))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package common_datalayer
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+type testAddress struct {
+	Street string `cdl:"street"`
+	City   string `cdl:"city"`
+}
+
+type testAudit struct {
+	Changed time.Time `cdl:"changed"`
+}
+
+type testPerson struct {
+	ID       string        `cdl:"id"`
+	Name     string        `cdl:"name"`
+	Age      int           `cdl:"age"`
+	Nickname *string       `cdl:"nickname"`
+	Address  testAddress   `cdl:"address"`
+	Previous []testAddress `cdl:"previous"`
+	Tags     []string      `cdl:"tags"`
+	Secret   string        `cdl:"-"`
+	Untagged bool
+	testAudit
+	internal int
+}
+
+func TestStructItem(t *testing.T) {
+	person := &testPerson{
+		ID: "1", Name: "Homer", Age: 39,
+		Address:  testAddress{Street: "742 Evergreen Terrace", City: "Springfield"},
+		Previous: []testAddress{{City: "Shelbyville"}},
+		Tags:     []string{"father"},
+	}
+	item, err := NewStructItem(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedNames := []string{"id", "name", "age", "nickname", "address", "previous", "tags", "Untagged", "changed"}
+	if !reflect.DeepEqual(item.GetPropertyNames(), expectedNames) {
+		t.Errorf("unexpected property names %v", item.GetPropertyNames())
+	}
+	// the names are not shared, sorting them keeps the field order of other items
+	sort.Strings(item.GetPropertyNames())
+	children(item)
+	other, _ := NewStructItem(&testPerson{})
+	if !reflect.DeepEqual(other.GetPropertyNames(), expectedNames) {
+		t.Errorf("property names changed by caller %v", other.GetPropertyNames())
+	}
+	if item.GetValue("nickname") != nil || item.GetValue("Secret") != nil || item.NativeItem() != person {
+		t.Errorf("unexpected values")
+	}
+
+	logger := NewLogger("testService", "text", "info")
+	outgoingConfig := &OutgoingMappingConfig{
+		BaseURI: "http://data.example.com/schema/",
+		PropertyMappings: []*ItemToEntityPropertyMapping{
+			{Property: "id", IsIdentity: true, URIValuePattern: "http://data.example.com/people/{value}"},
+			{Property: "age", EntityProperty: "age", Datatype: "long"},
+			{Property: "$.address.city", EntityProperty: "city"},
+			{Property: "$.previous[*].city", EntityProperty: "previousCities"},
+			{Property: "tags", EntityProperty: "tags"},
+		},
+	}
+	entity := egdm.NewEntity()
+	if err = NewMapper(logger, nil, outgoingConfig).MapItemToEntity(item, entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID != "http://data.example.com/people/1" || entity.Properties["http://data.example.com/schema/age"] != int64(39) ||
+		entity.Properties["http://data.example.com/schema/city"] != "Springfield" ||
+		!reflect.DeepEqual(entity.Properties["http://data.example.com/schema/previousCities"], []any{"Shelbyville"}) ||
+		!reflect.DeepEqual(entity.Properties["http://data.example.com/schema/tags"], []any{"father"}) {
+		t.Errorf("unexpected entity %+v", entity)
+	}
+
+	// values are converted to the field types
+	result := &testPerson{}
+	item, _ = NewStructItem(result)
+	item.SetValue("id", 1)
+	item.SetValue("age", "40")
+	item.SetValue("nickname", "Homie")
+	item.SetValue("address", map[string]any{"city": "Springfield"})
+	item.SetValue("previous", []any{map[string]any{"street": "Main Street"}})
+	item.SetValue("tags", "father")
+	item.SetValue("changed", "2024-01-02T03:04:05Z")
+	if item.Err() != nil {
+		t.Fatal(item.Err())
+	}
+	if result.ID != "1" || result.Age != 40 || *result.Nickname != "Homie" || result.Address.City != "Springfield" ||
+		result.Previous[0].Street != "Main Street" || result.Tags[0] != "father" ||
+		!result.Changed.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected struct %+v", result)
+	}
+
+	item.SetValue("age", "old")
+	item.SetValue("unknown", 1)
+	var conversionErr *ConversionError
+	if !errors.As(item.Err(), &conversionErr) || conversionErr.Property != "age" || conversionErr.Type != "int" {
+		t.Errorf("expected conversion error for age, got %v", item.Err())
+	}
+	if err = item.Set("unknown", 1); err == nil {
+		t.Errorf("expected error for unknown property")
+	}
+	if _, err = NewStructItem(*person); err == nil {
+		t.Errorf("expected error for struct value")
+	}
+}
@@ -0,0 +1,161 @@
+package common_datalayer
+
+import (
+	"errors"
+	"fmt"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// A sub_mapping on a property mapping maps nested objects, e.g. json objects read by the encoder
+// package, to sub-entities with their own property mappings, identity and type. Lists of nested
+// objects become lists of sub-entities. Incoming sub mappings turn sub-entities back into nested
+// objects, map[string]any, and lists of them. The base uri and namespaces of the parent mapping are
+// used if the sub mapping does not declare its own.
+
+// newSubMapper compiles the sub mapping configs of a property mapping into a mapper for the nested
+// values. Sub mapping configs without base uri or namespaces get baseURI and namespaces of the parent
+// mapping on a copy, so the configs of the dataset definitions stay as they were loaded.
+func newSubMapper(logger Logger, lookups *LookupTables, baseURI string, namespaces map[string]string, incoming *IncomingMappingConfig, outgoing *OutgoingMappingConfig) (*Mapper, error) {
+	if incoming != nil {
+		inherited := *incoming
+		inherited.BaseURI, inherited.Namespaces = inherit(incoming.BaseURI, incoming.Namespaces, baseURI, namespaces)
+		incoming = &inherited
+	}
+	if outgoing != nil {
+		inherited := *outgoing
+		inherited.BaseURI, inherited.Namespaces = inherit(outgoing.BaseURI, outgoing.Namespaces, baseURI, namespaces)
+		outgoing = &inherited
+	}
+	sub := &Mapper{logger: logger, incomingMappingConfig: incoming, outgoingMappingConfig: outgoing, lookups: lookups}
+	sub.verifyBaseUri()
+	if err := sub.compile(); err != nil {
+		return nil, fmt.Errorf("sub_mapping: %w", err)
+	}
+	return sub, nil
+}
+
+func inherit(baseURI string, namespaces map[string]string, parentBaseURI string, parentNamespaces map[string]string) (string, map[string]string) {
+	if baseURI == "" {
+		baseURI = parentBaseURI
+	}
+	if namespaces == nil {
+		namespaces = parentNamespaces
+	}
+	return baseURI, namespaces
+}
+
+// validateSubMapping rejects property mapping options that cannot be combined with a sub mapping
+func validateSubMapping(isIdentity, isReference, isDeleted, isRecorded bool, datatype string, separator string) error {
+	switch {
+	case isIdentity || isReference || isDeleted || isRecorded:
+		return errors.New("sub_mapping cannot be used for identities, references, deleted or recorded properties")
+	case datatype != "":
+		return errors.New("sub_mapping cannot be combined with a datatype")
+	case separator != "":
+		return errors.New("sub_mapping cannot be combined with a list_separator")
+	}
+	return nil
+}
+
+// mapNestedToEntities maps a nested object to a sub-entity, and a list of nested objects to a list
+// of sub-entities. Nested objects rejected by the filter of the sub mapping are left out, a single
+// one results in nil, or an empty list if isList.
+func (mapper *Mapper) mapNestedToEntities(value any, isList bool) (any, error) {
+	if values, ok := asList(value); ok {
+		entities := make([]*egdm.Entity, 0, len(values))
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			entity, err := mapper.nestedEntity(v)
+			if errors.Is(err, ErrItemFiltered) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("list element %d: %w", i, err)
+			}
+			entities = append(entities, entity)
+		}
+		return entities, nil
+	}
+	entity, err := mapper.nestedEntity(value)
+	if errors.Is(err, ErrItemFiltered) {
+		if isList {
+			return []*egdm.Entity{}, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isList {
+		return []*egdm.Entity{entity}, nil
+	}
+	return entity, nil
+}
+
+func (mapper *Mapper) nestedEntity(value any) (*egdm.Entity, error) {
+	var item Item
+	switch v := value.(type) {
+	case map[string]any:
+		item = MapItem(v)
+	case Item:
+		item = v
+	default:
+		return nil, fmt.Errorf("sub_mapping requires nested objects, got %T", value)
+	}
+	entity := egdm.NewEntity()
+	if err := mapper.MapItemToEntity(item, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// mapNestedToItems maps a sub-entity to a nested object, and a list of sub-entities to a list of
+// nested objects. Filtered sub-entities are left out like in mapNestedToEntities.
+func (mapper *Mapper) mapNestedToItems(value any, isList bool) (any, error) {
+	if values, ok := asList(value); ok {
+		objects := make([]any, 0, len(values))
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			object, err := mapper.nestedObject(v)
+			if errors.Is(err, ErrItemFiltered) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("list element %d: %w", i, err)
+			}
+			objects = append(objects, object)
+		}
+		return objects, nil
+	}
+	object, err := mapper.nestedObject(value)
+	if errors.Is(err, ErrItemFiltered) {
+		if isList {
+			return []any{}, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isList {
+		return []any{object}, nil
+	}
+	return object, nil
+}
+
+func (mapper *Mapper) nestedObject(value any) (map[string]any, error) {
+	entity, ok := value.(*egdm.Entity)
+	if !ok {
+		return nil, fmt.Errorf("sub_mapping requires sub-entities, got %T", value)
+	}
+	object := MapItem{}
+	if err := mapper.MapEntityToItem(entity, object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
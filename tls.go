@@ -0,0 +1,249 @@
+package common_datalayer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TLSConfig enables TLS termination in the layer http server. When ClientCAFile is set,
+// client certificates are verified against the CA bundle (mutual TLS).
+type TLSConfig struct {
+	CertFile       string `json:"cert_file"`
+	KeyFile        string `json:"key_file"`
+	ClientCAFile   string `json:"client_ca_file"`
+	ClientAuth     string `json:"client_auth"`     // one of none, request, require. defaults to require when client_ca_file is set
+	ReloadInterval string `json:"reload_interval"` // how often certificate files are checked for changes, e.g. 30s, 5m
+}
+
+func (c *TLSConfig) enabled() bool {
+	return c != nil && c.CertFile != ""
+}
+
+func (c *TLSConfig) clientAuthType() (tls.ClientAuthType, error) {
+	switch c.ClientAuth {
+	case "":
+		if c.ClientCAFile != "" {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("invalid client_auth %s. valid values: none, request, require", c.ClientAuth)
+	}
+}
+
+// certReloader keeps the server certificate and client CA pool in memory and
+// reloads them when the underlying files are modified.
+type certReloader struct {
+	mu         sync.RWMutex
+	config     *TLSConfig
+	clientAuth tls.ClientAuthType
+	logger     Logger
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+	modTimes   map[string]time.Time
+	ticker     *time.Ticker
+}
+
+func newCertReloader(config *TLSConfig, logger Logger) (*certReloader, error) {
+	if config.KeyFile == "" {
+		return nil, errors.New("tls key_file is required when cert_file is set")
+	}
+	clientAuth, err := config.clientAuthType()
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth == tls.RequireAndVerifyClientCert && config.ClientCAFile == "" {
+		return nil, errors.New("tls client_ca_file is required when client_auth is require")
+	}
+
+	r := &certReloader{config: config, clientAuth: clientAuth, logger: logger, modTimes: make(map[string]time.Time)}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	interval := time.Minute
+	if config.ReloadInterval != "" {
+		interval, err = asDuration(config.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.ticker = time.NewTicker(interval)
+	go func() {
+		for range r.ticker.C {
+			r.reloadIfChanged()
+		}
+	}()
+
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("could not stat tls file %s: %w", f, err)
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("could not load tls key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("could not read tls client_ca_file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in tls client_ca_file %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			// files may be missing briefly while being replaced
+			return false
+		}
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadIfChanged reloads certificates if any of the files changed. On failure the
+// previously loaded certificates are kept.
+func (r *certReloader) reloadIfChanged() {
+	if !r.changed() {
+		return
+	}
+	if err := r.load(); err != nil {
+		r.logger.Error("Failed to reload tls certificates", "error", err.Error())
+		return
+	}
+	r.logger.Info("Reloaded tls certificates", "cert_file", r.config.CertFile)
+}
+
+// tlsConfig returns a tls.Config that resolves certificates and client CAs
+// per handshake, so reloaded files take effect for new connections.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCAs,
+				ClientAuth:   r.clientAuth,
+			}, nil
+		},
+	}
+}
+
+func (r *certReloader) Stop(ctx context.Context) error {
+	r.ticker.Stop()
+	return nil
+}
+
+/******************************************************************************/
+
+// ClientIdentity describes the caller of a request as established by the layer http server.
+type ClientIdentity struct {
+	// Name is the subject common name of the verified client certificate, or the
+	// remote address when no client certificate was presented
+	Name string
+	// Certificate is the verified client certificate, nil when not using mutual TLS
+	Certificate *x509.Certificate
+}
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFromContext returns the client identity of the request the context
+// belongs to. The web service passes the request context to FullSync and Incremental.
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	if ctx == nil {
+		return nil
+	}
+	identity, _ := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	return identity
+}
+
+// clientIdentityMiddleware resolves the client identity and stores it in the request context.
+func clientIdentityMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		identity := &ClientIdentity{Name: remoteAddress(c)}
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			cert := req.TLS.VerifiedChains[0][0]
+			identity.Certificate = cert
+			identity.Name = cert.Subject.CommonName
+			if identity.Name == "" && len(cert.DNSNames) > 0 {
+				identity.Name = cert.DNSNames[0]
+			}
+		}
+		c.SetRequest(req.WithContext(context.WithValue(req.Context(), clientIdentityKey{}, identity)))
+		return next(c)
+	}
+}
+
+// remoteAddress returns the host of the remote address of the request. Forwarding headers like
+// X-Forwarded-For are set by the client, they are only used when an IPExtractor is configured on echo.
+func remoteAddress(c echo.Context) string {
+	if c.Echo().IPExtractor != nil {
+		return c.RealIP()
+	}
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return host
+}
+
+// RequestAuthorizer can optionally be implemented by a DataLayerService to allow or deny
+// requests based on the client identity. Operation is one of read or write.
+type RequestAuthorizer interface {
+	Authorize(ctx context.Context, identity *ClientIdentity, dataset string, operation string) LayerError
+}
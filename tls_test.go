@@ -0,0 +1,203 @@
+package common_datalayer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func makeTestCert(t *testing.T, cn string, serial int64, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLSClientIdentity(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	dir := t.TempDir()
+	ca := makeTestCert(t, "test-ca", 1, nil, true)
+	server := makeTestCert(t, "localhost", 2, ca, false)
+	client := makeTestCert(t, "pipeline-1", 3, ca, false)
+	writeTestFile(t, filepath.Join(dir, "server.crt"), server.certPEM)
+	writeTestFile(t, filepath.Join(dir, "server.key"), server.keyPEM)
+	writeTestFile(t, filepath.Join(dir, "ca.crt"), ca.certPEM)
+
+	reloader, err := newCertReloader(&TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Stop(context.Background())
+
+	e := echo.New()
+	e.Use(clientIdentityMiddleware)
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, ClientIdentityFromContext(c.Request().Context()).Name)
+	})
+	ts := httptest.NewUnstartedServer(e)
+	ts.TLS = reloader.tlsConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+	resp, err := httpClient.Get(ts.URL + "/whoami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "pipeline-1" {
+		t.Errorf("expected client identity pipeline-1, got %s", string(body))
+	}
+
+	// without client certificate the handshake must fail
+	anonymousClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	_, err = anonymousClient.Get(ts.URL + "/whoami")
+	if err == nil {
+		t.Error("expected request without client certificate to be rejected")
+	}
+}
+
+func TestClientIdentityIgnoresForwardingHeaders(t *testing.T) {
+	e := echo.New()
+	e.Use(clientIdentityMiddleware)
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, ClientIdentityFromContext(c.Request().Context()).Name)
+	})
+	whoami := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", "10.1.2.3")
+		req.Header.Set("X-Real-IP", "10.1.2.3")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if name := whoami(); name != "192.0.2.1" {
+		t.Errorf("expected remote address as identity, got %s", name)
+	}
+
+	// forwarding headers are trusted when an extractor for the proxies is configured
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(echo.TrustIPRange(&net.IPNet{IP: net.ParseIP("192.0.2.0"), Mask: net.CIDRMask(24, 32)}))
+	if name := whoami(); name != "10.1.2.3" {
+		t.Errorf("expected forwarded address with trusted proxy, got %s", name)
+	}
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	dir := t.TempDir()
+	first := makeTestCert(t, "localhost", 10, nil, false)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	writeTestFile(t, certFile, first.certPEM)
+	writeTestFile(t, keyFile, first.keyPEM)
+
+	reloader, err := newCertReloader(&TLSConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: "1h"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Stop(context.Background())
+
+	second := makeTestCert(t, "localhost", 11, nil, false)
+	writeTestFile(t, certFile, second.certPEM)
+	writeTestFile(t, keyFile, second.keyPEM)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	_ = os.Chtimes(keyFile, later, later)
+
+	reloader.reloadIfChanged()
+	leaf, _ := x509.ParseCertificate(reloader.cert.Certificate[0])
+	if leaf.SerialNumber.Int64() != 11 {
+		t.Errorf("expected reloaded certificate with serial 11, got %d", leaf.SerialNumber.Int64())
+	}
+
+	// a broken key pair keeps the previous certificate
+	writeTestFile(t, keyFile, first.keyPEM)
+	evenLater := later.Add(time.Minute)
+	_ = os.Chtimes(keyFile, evenLater, evenLater)
+	reloader.reloadIfChanged()
+	leaf, _ = x509.ParseCertificate(reloader.cert.Certificate[0])
+	if leaf.SerialNumber.Int64() != 11 {
+		t.Errorf("expected certificate with serial 11 to be kept, got %d", leaf.SerialNumber.Int64())
+	}
+}
+
+func TestTLSConfigClientAuthValidation(t *testing.T) {
+	logger := NewLogger("testService", "text", "info")
+	_, err := newCertReloader(&TLSConfig{CertFile: "a.crt", KeyFile: "a.key", ClientAuth: "require"}, logger)
+	if err == nil {
+		t.Error("expected error when client_auth is require without client_ca_file")
+	}
+	_, err = newCertReloader(&TLSConfig{CertFile: "a.crt", KeyFile: "a.key", ClientAuth: "sometimes"}, logger)
+	if err == nil {
+		t.Error("expected error for invalid client_auth")
+	}
+}
@@ -0,0 +1,154 @@
+package common_datalayer
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// URI value patterns build entity ids and reference URIs from item values, e.g.
+// http://data.example.com/orgs/{orgId}/users/{userId}. The {value} placeholder is the value of the
+// mapped property, other placeholders are item properties. Incoming mappings use the same pattern
+// to parse entity ids and references back into item properties.
+//
+// Values of named placeholders are escaped as path segments, so they can contain any character
+// and are recovered exactly when parsing. {value} only escapes characters that are not allowed in
+// URIs, such as spaces and non-ASCII characters, so that it can still hold complete URIs or paths.
+
+const valuePlaceholder = "value"
+
+var uriPlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+type uriPattern struct {
+	source   string
+	literals []string // literals[i] precedes names[i], the last literal follows the last name
+	names    []string
+	regex    *regexp.Regexp
+}
+
+var uriPatternCache sync.Map
+
+func compileURIPattern(pattern string) (*uriPattern, error) {
+	if p, ok := uriPatternCache.Load(pattern); ok {
+		return p.(*uriPattern), nil
+	}
+	p := &uriPattern{source: pattern}
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	last := 0
+	seen := make(map[string]bool)
+	for _, match := range uriPlaceholderPattern.FindAllStringSubmatchIndex(pattern, -1) {
+		name := pattern[match[2]:match[3]]
+		if name == "" {
+			return nil, fmt.Errorf("invalid uri pattern '%s': empty placeholder", pattern)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid uri pattern '%s': placeholder {%s} is used more than once", pattern, name)
+		}
+		seen[name] = true
+		literal := pattern[last:match[0]]
+		p.literals = append(p.literals, literal)
+		p.names = append(p.names, name)
+		expr.WriteString(regexp.QuoteMeta(literal))
+		expr.WriteString("(.+?)")
+		last = match[1]
+	}
+	p.literals = append(p.literals, pattern[last:])
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+	if strings.ContainsAny(strings.Join(p.literals, ""), "{}") {
+		return nil, fmt.Errorf("invalid uri pattern '%s': unbalanced braces", pattern)
+	}
+	var err error
+	if p.regex, err = regexp.Compile(expr.String()); err != nil {
+		return nil, fmt.Errorf("invalid uri pattern '%s': %w", pattern, err)
+	}
+	uriPatternCache.Store(pattern, p)
+	return p, nil
+}
+
+// hasNamedPlaceholders returns true if the pattern uses placeholders other than {value}
+func (p *uriPattern) hasNamedPlaceholders() bool {
+	for _, name := range p.names {
+		if name != valuePlaceholder {
+			return true
+		}
+	}
+	return false
+}
+
+// expand replaces the placeholders with escaped values, value is used for {value} and item
+// properties for all other placeholders
+func (p *uriPattern) expand(value any, item Item) (string, error) {
+	result := strings.Builder{}
+	for i, name := range p.names {
+		result.WriteString(p.literals[i])
+		v := value
+		if name != valuePlaceholder {
+			var err error
+			if v, err = getItemValue(item, name); err != nil {
+				return "", err
+			}
+		}
+		if v == nil {
+			return "", fmt.Errorf("no value for placeholder {%s} in uri pattern '%s'", name, p.source)
+		}
+		s, err := stringOfValue(v)
+		if err != nil {
+			return "", fmt.Errorf("placeholder {%s} in uri pattern '%s': %w", name, p.source, err)
+		}
+		if name == valuePlaceholder {
+			result.WriteString(escapeURIValue(s))
+		} else {
+			result.WriteString(url.PathEscape(s))
+		}
+	}
+	result.WriteString(p.literals[len(p.literals)-1])
+	return result.String(), nil
+}
+
+// parse matches uri against the pattern and returns the unescaped placeholder values
+func (p *uriPattern) parse(uri string) (map[string]string, error) {
+	match := p.regex.FindStringSubmatch(uri)
+	if match == nil {
+		return nil, fmt.Errorf("'%s' does not match uri pattern '%s'", uri, p.source)
+	}
+	values := make(map[string]string, len(p.names))
+	for i, name := range p.names {
+		value, err := url.PathUnescape(match[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("'%s' does not match uri pattern '%s': %w", uri, p.source, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// escapeURIValue percent-encodes all characters that are neither unreserved nor reserved in URIs.
+// Existing percent-encodings are kept, so that encoded values are not encoded twice.
+func escapeURIValue(s string) string {
+	result := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if isURIChar(b) || (b == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2])) {
+			result.WriteByte(b)
+		} else {
+			fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+func isHex(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+func isURIChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~:/?#[]@!$&'()*+,;=", b) >= 0
+}
@@ -0,0 +1,56 @@
+package common_datalayer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestURIPatterns(t *testing.T) {
+	item := &InMemoryItem{properties: map[string]any{"orgId": "acme inc", "userId": 42, "path": "a/b"}}
+
+	tests := []struct {
+		pattern  string
+		value    any
+		expected string
+	}{
+		{pattern: "http://data.example.com/{value}", value: "1", expected: "http://data.example.com/1"},
+		{pattern: "http://data.example.com/{value}", value: "Ærlig talt", expected: "http://data.example.com/%C3%86rlig%20talt"},
+		{pattern: "{value}", value: "http://data.example.com/a%20b", expected: "http://data.example.com/a%20b"},
+		{pattern: "http://data.example.com/orgs/{orgId}/users/{userId}", expected: "http://data.example.com/orgs/acme%20inc/users/42"},
+		{pattern: "http://data.example.com/{path}-{value}", value: "x", expected: "http://data.example.com/a%2Fb-x"},
+	}
+	for _, test := range tests {
+		p, err := compileURIPattern(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uri, err := p.expand(test.value, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uri != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.pattern, test.expected, uri)
+		}
+	}
+
+	p, _ := compileURIPattern("http://data.example.com/orgs/{orgId}/users/{userId}")
+	values, err := p.parse("http://data.example.com/orgs/acme%20inc/users/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, map[string]string{"orgId": "acme inc", "userId": "42"}) {
+		t.Errorf("unexpected values %v", values)
+	}
+	if _, err := p.parse("http://data.example.com/users/42"); err == nil {
+		t.Errorf("expected error for uri not matching the pattern")
+	}
+	if _, err := p.expand(nil, &InMemoryItem{properties: map[string]any{"orgId": "acme"}}); err == nil {
+		t.Errorf("expected error for missing placeholder value")
+	}
+
+	for _, invalid := range []string{"http://x/{}", "http://x/{a}/{a}", "http://x/{a"} {
+		if _, err := compileURIPattern(invalid); err == nil {
+			t.Errorf("%s: expected error", invalid)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package common_datalayer
 
 import (
 	"context"
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -16,6 +17,9 @@ import (
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 )
 
+//go:embed openapi.json
+var openAPISpec []byte
+
 type dataLayerWebService struct {
 	// service specific service core
 	datalayerService DataLayerService
@@ -23,6 +27,8 @@ type dataLayerWebService struct {
 	metrics          Metrics
 	logger           Logger
 	config           *Config
+	certReloader     *certReloader
+	limiter          *rateLimiter
 }
 
 func newDataLayerWebService(config *Config, logger Logger, metrics Metrics, dataLayerService DataLayerService) (*dataLayerWebService, error) {
@@ -33,11 +39,27 @@ func newDataLayerWebService(config *Config, logger Logger, metrics Metrics, data
 
 	s := &dataLayerWebService{config: config, logger: logger, metrics: metrics, datalayerService: dataLayerService, e: e}
 
+	if config.LayerServiceConfig.TLS.enabled() {
+		reloader, err := newCertReloader(config.LayerServiceConfig.TLS, logger)
+		if err != nil {
+			logger.Error("Failed to load tls configuration", "error", err.Error())
+			return nil, err
+		}
+		s.certReloader = reloader
+	}
+	e.Use(clientIdentityMiddleware)
+
 	e.GET("/health", s.health)
-	e.POST("/datasets/:dataset/entities", s.postEntities)
-	e.GET("/datasets/:dataset/entities", s.getEntities)
-	e.GET("/datasets/:dataset/changes", s.getChanges)
+	s.limiter = newRateLimiter(config, func(dataset string) bool {
+		_, err := dataLayerService.Dataset(dataset)
+		return err == nil
+	}, logger, metrics)
+	e.POST("/datasets/:dataset/entities", s.postEntities, s.limiter.middleware)
+	e.GET("/datasets/:dataset/entities", s.getEntities, s.limiter.middleware)
+	e.GET("/datasets/:dataset/changes", s.getChanges, s.limiter.middleware)
 	e.GET("/datasets", s.listDatasets)
+	e.GET("/datasets/:dataset", s.getDataset)
+	e.GET("/openapi.json", s.openAPI)
 
 	return s, nil
 }
@@ -133,6 +155,16 @@ func mw(logger Logger, metrics Metrics, e *echo.Echo) {
 
 func (ws *dataLayerWebService) Start() error {
 	port := ws.config.LayerServiceConfig.Port
+	if ws.certReloader != nil {
+		ws.logger.Info(fmt.Sprintf("Starting Https server on :%s", port))
+		ws.e.TLSServer.Addr = ":" + port.String()
+		ws.e.TLSServer.TLSConfig = ws.certReloader.tlsConfig()
+		go func() {
+			_ = ws.e.StartServer(ws.e.TLSServer)
+		}()
+		return nil
+	}
+
 	ws.logger.Info(fmt.Sprintf("Starting Http server on :%s", port))
 	go func() {
 		_ = ws.e.Start(":" + port.String())
@@ -142,9 +174,33 @@ func (ws *dataLayerWebService) Start() error {
 }
 
 func (ws *dataLayerWebService) Stop(ctx context.Context) error {
+	if ws.certReloader != nil {
+		_ = ws.certReloader.Stop(ctx)
+	}
 	return ws.e.Shutdown(ctx)
 }
 
+// UpdateConfiguration rebuilds the rate limiters from the updated config
+func (ws *dataLayerWebService) UpdateConfiguration(config *Config) LayerError {
+	ws.limiter.update(config)
+	return nil
+}
+
+// authorize delegates to the layer service if it implements RequestAuthorizer
+func (ws *dataLayerWebService) authorize(c echo.Context, datasetName string, operation string) error {
+	authorizer, ok := ws.datalayerService.(RequestAuthorizer)
+	if !ok {
+		return nil
+	}
+	ctx := c.Request().Context()
+	err := authorizer.Authorize(ctx, ClientIdentityFromContext(ctx), datasetName, operation)
+	if err != nil {
+		ws.logger.Warn("Request not authorized", "dataset", datasetName, "operation", operation, "error", err.Error())
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	return nil
+}
+
 // TODO mechanism to add health checks from layer code
 func (ws *dataLayerWebService) health(c echo.Context) error {
 	return c.String(http.StatusOK, "running")
@@ -157,14 +213,12 @@ func getBoolFromString(s string) bool {
 func (ws *dataLayerWebService) postEntities(c echo.Context) error {
 	datasetName, _ := url.QueryUnescape(c.Param("dataset"))
 	ws.logger.Info(fmt.Sprintf("POST to dataset %s", datasetName))
-	ds, err := ws.datalayerService.Dataset(datasetName)
-	if err != nil {
-		ws.logger.Warn(err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, "could not find dataset "+datasetName)
+	if err := ws.authorize(c, datasetName, "write"); err != nil {
+		return err
 	}
-	if ds == nil {
-		ws.logger.Error(fmt.Sprintf("dataset not found: %s", datasetName))
-		return echo.NewHTTPError(http.StatusNotFound, "dataset not found")
+	ds, notFound := ws.dataset(datasetName)
+	if notFound != nil {
+		return notFound
 	}
 
 	// get UDA full sync headers
@@ -183,16 +237,29 @@ func (ws *dataLayerWebService) postEntities(c echo.Context) error {
 		}
 	}
 
+	fullSyncDataset, supportsFullSync := ds.(FullSyncDataset)
+	incrementalDataset, supportsIncremental := ds.(IncrementalDataset)
+	if !supportsFullSync && !supportsIncremental {
+		return ws.methodNotAllowed(c, ds, "writing entities")
+	}
+
 	var writer DatasetWriter
+	var err LayerError
 
 	if udaFullSyncId != "" {
-		writer, err = ds.FullSync(context.Background(), batchInfo)
+		if !supportsFullSync {
+			return echo.NewHTTPError(http.StatusNotImplemented, fmt.Sprintf("dataset %s does not support full sync", datasetName))
+		}
+		writer, err = fullSyncDataset.FullSync(c.Request().Context(), batchInfo)
 	} else {
-		writer, err = ds.Incremental(context.Background())
+		if !supportsIncremental {
+			return echo.NewHTTPError(http.StatusNotImplemented, fmt.Sprintf("dataset %s does not support incremental writes", datasetName))
+		}
+		writer, err = incrementalDataset.Incremental(c.Request().Context())
 	}
 	if err != nil {
 		ws.logger.Warn(err.Error())
-		return echo.NewHTTPError(http.StatusInternalServerError, "could not create dataset writer")
+		return err.toHTTPError()
 	}
 
 	parser := egdm.NewEntityParser(egdm.NewNamespaceContext())
@@ -224,10 +291,16 @@ func (ws *dataLayerWebService) postEntities(c echo.Context) error {
 func (ws *dataLayerWebService) getEntities(c echo.Context) error {
 	datasetName, _ := url.QueryUnescape(c.Param("dataset"))
 	ws.logger.Info(fmt.Sprintf("GET entities for dataset %s", datasetName))
-	ds, err := ws.datalayerService.Dataset(datasetName)
-	if err != nil {
-		ws.logger.Error(fmt.Sprintf("dataset not found: %s", datasetName))
-		return err.toHTTPError()
+	if err := ws.authorize(c, datasetName, "read"); err != nil {
+		return err
+	}
+	ds, notFound := ws.dataset(datasetName)
+	if notFound != nil {
+		return notFound
+	}
+	entitiesDataset, ok := ds.(EntitiesDataset)
+	if !ok {
+		return ws.methodNotAllowed(c, ds, "reading entities")
 	}
 
 	since := c.QueryParam("since")
@@ -248,9 +321,9 @@ func (ws *dataLayerWebService) getEntities(c echo.Context) error {
 		take = limitVal
 	}
 
-	entityIterator, err := ds.Entities(from, take)
+	entityIterator, err := entitiesDataset.Entities(from, take)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err.toHTTPError()
 	}
 	return ws.writeEntities(c, entityIterator)
 }
@@ -258,14 +331,23 @@ func (ws *dataLayerWebService) getEntities(c echo.Context) error {
 func (ws *dataLayerWebService) getChanges(c echo.Context) error {
 	datasetName, _ := url.QueryUnescape(c.Param("dataset"))
 	ws.logger.Info(fmt.Sprintf("GET changes for dataset %s", datasetName))
-	ds, err := ws.datalayerService.Dataset(datasetName)
-	if err != nil {
-		ws.logger.Error(fmt.Sprintf("dataset not found: %s", datasetName))
-		return err.toHTTPError()
+	if err := ws.authorize(c, datasetName, "read"); err != nil {
+		return err
+	}
+	ds, notFound := ws.dataset(datasetName)
+	if notFound != nil {
+		return notFound
+	}
+	changesDataset, ok := ds.(ChangesDataset)
+	if !ok {
+		return ws.methodNotAllowed(c, ds, "reading changes")
 	}
 
 	// get since query param
 	since := c.QueryParam("since")
+	if since != "" && !supportsSince(ds) {
+		return echo.NewHTTPError(http.StatusNotImplemented, fmt.Sprintf("dataset %s does not support the since parameter", datasetName))
+	}
 
 	take := 0 // default to 0 indicating no limit
 	limit := c.QueryParam("limit")
@@ -279,10 +361,13 @@ func (ws *dataLayerWebService) getChanges(c echo.Context) error {
 
 	// get the latestOnly param
 	latestOnly := getBoolFromString(c.QueryParam("latestOnly"))
+	if latestOnly && !supportsLatestOnly(ds) {
+		return echo.NewHTTPError(http.StatusNotImplemented, fmt.Sprintf("dataset %s does not support the latestOnly parameter", datasetName))
+	}
 
-	entityIterator, err := ds.Changes(since, take, latestOnly)
+	entityIterator, err := changesDataset.Changes(since, take, latestOnly)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err.toHTTPError()
 	}
 	err2 := ws.writeEntities(c, entityIterator)
 	if err2 != nil {
@@ -292,6 +377,44 @@ func (ws *dataLayerWebService) getChanges(c echo.Context) error {
 	return nil
 }
 
+// dataset returns the named dataset, or a 404 error if the layer service has no such dataset
+func (ws *dataLayerWebService) dataset(datasetName string) (Dataset, error) {
+	ds, err := ws.datalayerService.Dataset(datasetName)
+	if err != nil || ds == nil {
+		ws.logger.Warn(fmt.Sprintf("dataset not found: %s", datasetName))
+		return nil, echo.NewHTTPError(http.StatusNotFound, "dataset not found")
+	}
+	return ds, nil
+}
+
+// methodNotAllowed responds with 405 and an Allow header with the methods the dataset supports
+// on the requested route. The header is empty if the dataset supports no method on the route.
+func (ws *dataLayerWebService) methodNotAllowed(c echo.Context, ds Dataset, operation string) error {
+	c.Response().Header().Set(echo.HeaderAllow, strings.Join(allowedMethods(c.Path(), ds), ", "))
+	return echo.NewHTTPError(http.StatusMethodNotAllowed, fmt.Sprintf("dataset %s does not support %s", ds.Name(), operation))
+}
+
+// allowedMethods returns the methods ds supports on the dataset route path
+func allowedMethods(path string, ds Dataset) []string {
+	allowed := make([]string, 0, 2)
+	switch {
+	case strings.HasSuffix(path, "/entities"):
+		if _, ok := ds.(EntitiesDataset); ok {
+			allowed = append(allowed, http.MethodGet)
+		}
+		_, supportsFullSync := ds.(FullSyncDataset)
+		_, supportsIncremental := ds.(IncrementalDataset)
+		if supportsFullSync || supportsIncremental {
+			allowed = append(allowed, http.MethodPost)
+		}
+	case strings.HasSuffix(path, "/changes"):
+		if _, ok := ds.(ChangesDataset); ok {
+			allowed = append(allowed, http.MethodGet)
+		}
+	}
+	return allowed
+}
+
 func (ws *dataLayerWebService) writeEntities(c echo.Context, entityIterator EntityIterator) error {
 	defer entityIterator.Close()
 	// write context
@@ -371,7 +494,21 @@ func (ws *dataLayerWebService) writeEntities(c echo.Context, entityIterator Enti
 
 func (ws *dataLayerWebService) listDatasets(c echo.Context) error {
 	ws.logger.Info("listing datasets")
-	b, err := json.Marshal(ws.datalayerService.DatasetDescriptions())
+	descriptions := make([]*DatasetDescription, 0)
+	for _, d := range ws.datalayerService.DatasetDescriptions() {
+		ds, _ := ws.datalayerService.Dataset(d.Name)
+		descriptions = append(descriptions, describeDataset(ws.logger, ds, d, ws.config.GetDatasetDefinition(d.Name)))
+	}
+	descriptions = filterDatasetDescriptions(descriptions, c.QueryParam("name"), c.QueryParam("capability"), c.QueryParam("type"))
+	// entity counts and last changes are only computed for the datasets in the result, and only on request
+	if c.QueryParam("statistics") == "true" {
+		for _, d := range descriptions {
+			ds, _ := ws.datalayerService.Dataset(d.Name)
+			addDatasetStatistics(ws.logger, ds, d)
+		}
+	}
+
+	b, err := json.Marshal(descriptions)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -381,3 +518,29 @@ func (ws *dataLayerWebService) listDatasets(c echo.Context) error {
 	}
 	return nil
 }
+
+func (ws *dataLayerWebService) getDataset(c echo.Context) error {
+	datasetName, _ := url.QueryUnescape(c.Param("dataset"))
+	ws.logger.Info(fmt.Sprintf("GET description of dataset %s", datasetName))
+	if err := ws.authorize(c, datasetName, "read"); err != nil {
+		return err
+	}
+	ds, notFound := ws.dataset(datasetName)
+	if notFound != nil {
+		return notFound
+	}
+
+	var description *DatasetDescription
+	for _, d := range ws.datalayerService.DatasetDescriptions() {
+		if d.Name == datasetName {
+			description = d
+			break
+		}
+	}
+
+	return c.JSON(http.StatusOK, newDatasetDetails(ws.logger, ds, description, ws.config.GetDatasetDefinition(datasetName)))
+}
+
+func (ws *dataLayerWebService) openAPI(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, openAPISpec)
+}
@@ -0,0 +1,138 @@
+package common_datalayer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+type webTestService struct {
+	datasets map[string]Dataset
+}
+
+func (s *webTestService) Stop(ctx context.Context) error                { return nil }
+func (s *webTestService) UpdateConfiguration(config *Config) LayerError { return nil }
+func (s *webTestService) DatasetDescriptions() []*DatasetDescription {
+	var descriptions []*DatasetDescription
+	for name := range s.datasets {
+		descriptions = append(descriptions, &DatasetDescription{Name: name})
+	}
+	return descriptions
+}
+func (s *webTestService) Dataset(dataset string) (Dataset, LayerError) {
+	if ds, ok := s.datasets[dataset]; ok {
+		return ds, nil
+	}
+	return nil, Errorf(LayerErrorBadParameter, "dataset %s not found", dataset)
+}
+
+type webTestIterator struct{}
+
+func (i *webTestIterator) Context() *egdm.Context                  { return nil }
+func (i *webTestIterator) Next() (*egdm.Entity, LayerError)        { return nil, nil }
+func (i *webTestIterator) Token() (*egdm.Continuation, LayerError) { return nil, nil }
+func (i *webTestIterator) Close() LayerError                       { return nil }
+
+// webTestChangesDataset only supports reading changes, without since
+type webTestChangesDataset struct{}
+
+func (d *webTestChangesDataset) MetaData() map[string]any { return nil }
+func (d *webTestChangesDataset) Name() string             { return "changes-only" }
+func (d *webTestChangesDataset) SupportsSince() bool      { return false }
+func (d *webTestChangesDataset) Changes(since string, limit int, latestOnly bool) (EntityIterator, LayerError) {
+	return &webTestIterator{}, nil
+}
+
+type webTestWriter struct{}
+
+func (w *webTestWriter) Write(entity *egdm.Entity) LayerError { return nil }
+func (w *webTestWriter) Close() LayerError                    { return nil }
+
+// webTestIncrementalDataset only supports incremental writes
+type webTestIncrementalDataset struct{}
+
+func (d *webTestIncrementalDataset) MetaData() map[string]any { return nil }
+func (d *webTestIncrementalDataset) Name() string             { return "incremental-only" }
+func (d *webTestIncrementalDataset) Incremental(ctx context.Context) (DatasetWriter, LayerError) {
+	return &webTestWriter{}, nil
+}
+
+func TestWebServiceHonoursDatasetCapabilities(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	config := &Config{LayerServiceConfig: &LayerServiceConfig{}}
+	metrics, _ := newMetrics(config)
+	service := &webTestService{datasets: map[string]Dataset{
+		"changes-only":     &webTestChangesDataset{},
+		"incremental-only": &webTestIncrementalDataset{},
+	}}
+	ws, err := newDataLayerWebService(config, logger, metrics, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method  string
+		target  string
+		headers map[string]string
+		status  int
+		allow   string
+	}{
+		{method: http.MethodGet, target: "/datasets/changes-only/changes", status: http.StatusOK},
+		{method: http.MethodGet, target: "/datasets/changes-only/changes?since=abc", status: http.StatusNotImplemented},
+		{method: http.MethodGet, target: "/datasets/changes-only/entities", status: http.StatusMethodNotAllowed, allow: ""},
+		{method: http.MethodPost, target: "/datasets/changes-only/entities", status: http.StatusMethodNotAllowed, allow: ""},
+		{method: http.MethodGet, target: "/datasets/incremental-only/changes", status: http.StatusMethodNotAllowed, allow: ""},
+		{method: http.MethodGet, target: "/datasets/incremental-only/entities", status: http.StatusMethodNotAllowed, allow: "POST"},
+		{method: http.MethodPost, target: "/datasets/incremental-only/entities", status: http.StatusOK},
+		{
+			method:  http.MethodPost,
+			target:  "/datasets/incremental-only/entities",
+			headers: map[string]string{"universal-data-api-full-sync-id": "1", "universal-data-api-full-sync-start": "true"},
+			status:  http.StatusNotImplemented,
+		},
+		{method: http.MethodGet, target: "/datasets/unknown/changes", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/datasets/unknown/entities", status: http.StatusNotFound},
+		{method: http.MethodPost, target: "/datasets/unknown/entities", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/datasets/unknown", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(`[{"id": "@context", "namespaces": {}}]`))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		ws.e.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.target, test.status, rec.Code)
+		}
+		if test.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != test.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", test.method, test.target, test.allow, rec.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestListDatasetsStatisticsOnRequest(t *testing.T) {
+	logger := NewLogger("testService", "text", "debug")
+	config := &Config{LayerServiceConfig: &LayerServiceConfig{}}
+	metrics, _ := newMetrics(config)
+	service := &webTestService{datasets: map[string]Dataset{"people": &countingTestDataset{}}}
+	ws, err := newDataLayerWebService(config, logger, metrics, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for target, counted := range map[string]bool{"/datasets": false, "/datasets?statistics=true": true, "/datasets/people": true} {
+		rec := httptest.NewRecorder()
+		ws.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", target, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), `"entity_count":42`) != counted {
+			t.Errorf("%s: expected entity count %v, got %s", target, counted, rec.Body.String())
+		}
+	}
+}